@@ -0,0 +1,58 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/utils"
+	"github.com/openai/openai-go"
+)
+
+// maxCommitDiff caps the diff sent to generate a commit message
+const maxCommitDiff = 12000
+
+const commitMessagePrompt = `You write git commit messages in the Conventional Commits format.
+Reply with the commit message only, without code fences or quotes:
+- a subject line "<type>(<optional scope>): <summary>" of at most 72 characters, where type is one of feat, fix, refactor, docs, test, chore, style, perf, build or ci, and the summary is in the imperative mood
+- optionally a blank line and a short body explaining what changed and why`
+
+// GenerateCommitMessage asks the model for a conventional commit message
+// describing diff, the changes made for request
+func GenerateCommitMessage(ctx context.Context, request, diff string) (string, error) {
+	if len(diff) > maxCommitDiff {
+		diff = utils.TruncateText(diff, maxCommitDiff) + "\n... diff truncated"
+	}
+	params := openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(commitMessagePrompt),
+			openai.UserMessage(fmt.Sprintf("Request:\n%s\n\nDiff:\n%s", request, diff)),
+		},
+		Seed: openai.Int(0),
+	}
+
+	completion, _, err := createCompletion(ctx, config.GetOpenAIClient(), params, modelChain(), 0)
+	if err != nil {
+		return "", err
+	}
+	message := cleanCommitMessage(completion.Choices[0].Message.Content)
+	if message == "" {
+		return "", fmt.Errorf("the model returned an empty commit message")
+	}
+	return message, nil
+}
+
+// cleanCommitMessage strips the fences and quotes models tend to add anyway
+func cleanCommitMessage(message string) string {
+	message = strings.TrimSpace(message)
+	if strings.HasPrefix(message, "```") {
+		message = strings.TrimPrefix(message, "```")
+		if newline := strings.IndexByte(message, '\n'); newline >= 0 {
+			// Drop the fence language, e.g. ```text
+			message = message[newline+1:]
+		}
+		message = strings.TrimSuffix(strings.TrimSpace(message), "```")
+	}
+	return strings.Trim(strings.TrimSpace(message), "\"'`")
+}
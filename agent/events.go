@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// EventType identifies what happened in the tool loop
+type EventType string
+
+const (
+	// EventToolStart is emitted right before a tool is executed
+	EventToolStart EventType = "tool_start"
+	// EventToolEnd is emitted once a tool returned, successfully or not
+	EventToolEnd EventType = "tool_end"
+	// EventFileDiff is emitted before a file write with the change it will make
+	EventFileDiff EventType = "file_diff"
+	// EventLLMResponse is emitted after each chat completion with its token usage
+	EventLLMResponse EventType = "llm_response"
+)
+
+// Event describes progress of the tool loop so callers can render it live
+type Event struct {
+	Type      EventType
+	Iteration int
+	Model     string
+	Usage     openai.CompletionUsage
+	ToolName  string
+	ToolArgs  map[string]string
+	Path      string
+	Diff      string
+	Result    string
+	Err       error
+	Duration  time.Duration
+}
+
+// emit forwards an event to the loop's listener, if any
+func (l LoopConfig) emit(event Event) {
+	if l.OnEvent != nil {
+		l.OnEvent(event)
+	}
+}
+
+// emitUsage reports which model answered an iteration and the tokens it used
+func (l LoopConfig) emitUsage(iteration int, model string, completion *openai.ChatCompletion) {
+	l.emit(Event{
+		Type:      EventLLMResponse,
+		Iteration: iteration,
+		Model:     model,
+		Usage:     completion.Usage,
+	})
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/tracing"
+	"github.com/KacemMathlouthi/go-code/utils"
+	"github.com/openai/openai-go"
+)
+
+// sessionModel overrides the configured primary deployment when set
+var sessionModel string
+
+// SetModel switches the primary model for the rest of the session. An empty
+// name goes back to the configured deployment.
+func SetModel(name string) {
+	sessionModel = name
+}
+
+// CurrentModel returns the model tried first for new requests
+func CurrentModel() string {
+	return modelChain()[0]
+}
+
+// modelChain returns the models to try in order: the session model if any,
+// then the configured deployment and fallbacks
+func modelChain() []string {
+	chain := config.LoadEnvConfig().ModelChain()
+	if sessionModel == "" {
+		return chain
+	}
+
+	models := []string{sessionModel}
+	for _, model := range chain {
+		if model != sessionModel {
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// createCompletion sends the request to models[index] and, when the deployment
+// fails with a quota, outage or context-length error, retries the same request
+// on the next model of the chain. It returns the completion together with the
+// index of the model that answered so later iterations can stay on it.
+func createCompletion(ctx context.Context, client *openai.Client, params openai.ChatCompletionNewParams, models []string, index int) (*openai.ChatCompletion, int, error) {
+	var lastErr error
+	for ; index < len(models); index++ {
+		params.Model = models[index]
+
+		_, span := tracing.Start(ctx, "llm.completion", tracing.KindClient, map[string]interface{}{
+			"gen_ai.system":        "az.ai.openai",
+			"gen_ai.request.model": models[index],
+			"llm.fallback":         index > 0,
+			"llm.messages":         len(params.Messages),
+			"llm.tools_available":  len(params.Tools),
+		})
+		start := time.Now()
+		completion, err := client.Chat.Completions.New(ctx, params)
+		duration := time.Since(start)
+		traceCompletion(span, completion, err)
+
+		if err == nil {
+			utils.LogLLMResponse(completion.Choices[0].Message.Content, models[index], duration)
+			if index > 0 {
+				utils.LogInfo("Fallback model answered", "llm", map[string]interface{}{
+					"model":         models[index],
+					"primary_model": models[0],
+				})
+			}
+			return completion, index, nil
+		}
+
+		lastErr = err
+		if !isFallbackError(err) || index == len(models)-1 {
+			break
+		}
+
+		utils.LogWarning("Model failed, falling back to next model", "llm", map[string]interface{}{
+			"model":      models[index],
+			"next_model": models[index+1],
+			"error":      err.Error(),
+		})
+	}
+	return nil, index, lastErr
+}
+
+// traceCompletion records the outcome of a completion request on its span
+func traceCompletion(span *tracing.Span, completion *openai.ChatCompletion, err error) {
+	defer span.Finish()
+	if err != nil {
+		span.SetError(err)
+		var apiErr *openai.Error
+		if errors.As(err, &apiErr) {
+			span.SetAttribute("http.response.status_code", apiErr.StatusCode)
+		}
+		return
+	}
+
+	span.SetAttribute("gen_ai.response.model", completion.Model)
+	span.SetAttribute("gen_ai.usage.input_tokens", completion.Usage.PromptTokens)
+	span.SetAttribute("gen_ai.usage.output_tokens", completion.Usage.CompletionTokens)
+	if len(completion.Choices) > 0 {
+		span.SetAttribute("gen_ai.response.finish_reason", completion.Choices[0].FinishReason)
+		span.SetAttribute("llm.tool_calls", len(completion.Choices[0].Message.ToolCalls))
+	}
+}
+
+// isFallbackError reports whether err is worth retrying on another deployment
+func isFallbackError(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		// Network level failures (timeouts, refused connections) count as outages
+		return !errors.Is(err, context.Canceled)
+	}
+
+	if apiErr.Code == "context_length_exceeded" || strings.Contains(apiErr.Message, "maximum context length") {
+		return true
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusTooManyRequests, http.StatusNotFound:
+		return true
+	}
+	return apiErr.StatusCode >= http.StatusInternalServerError
+}
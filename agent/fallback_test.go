@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestIsFallbackError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &openai.Error{StatusCode: http.StatusTooManyRequests}, true},
+		{"missing deployment", &openai.Error{StatusCode: http.StatusNotFound}, true},
+		{"server error", &openai.Error{StatusCode: http.StatusServiceUnavailable}, true},
+		{"context length code", &openai.Error{StatusCode: http.StatusBadRequest, Code: "context_length_exceeded"}, true},
+		{"context length message", &openai.Error{StatusCode: http.StatusBadRequest, Message: "This model's maximum context length is 8192 tokens"}, true},
+		{"bad request", &openai.Error{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &openai.Error{StatusCode: http.StatusUnauthorized}, false},
+		{"wrapped api error", fmt.Errorf("request failed: %w", &openai.Error{StatusCode: http.StatusTooManyRequests}), true},
+		{"network error", errors.New("dial tcp: connection refused"), true},
+		{"canceled", fmt.Errorf("request failed: %w", context.Canceled), false},
+	}
+	for _, test := range tests {
+		if got := isFallbackError(test.err); got != test.want {
+			t.Errorf("isFallbackError(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestModelChain(t *testing.T) {
+	t.Setenv("AZURE_DEPLOYMENT_NAME", "primary")
+	t.Setenv("AZURE_FALLBACK_DEPLOYMENTS", "backup, primary,,other")
+	defer SetModel("")
+
+	tests := []struct {
+		session string
+		want    []string
+	}{
+		{"", []string{"primary", "backup", "other"}},
+		{"backup", []string{"backup", "primary", "other"}},
+		{"custom", []string{"custom", "primary", "backup", "other"}},
+	}
+	for _, test := range tests {
+		SetModel(test.session)
+		if got := modelChain(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("modelChain() with session model %q = %q, want %q", test.session, got, test.want)
+		}
+		if got := CurrentModel(); got != test.want[0] {
+			t.Errorf("CurrentModel() = %q, want %q", got, test.want[0])
+		}
+	}
+}
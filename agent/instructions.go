@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// InstructionFileName is the name of the project instruction files
+const InstructionFileName = "GOCODE.md"
+
+// maxInstructionFileSize caps how much of a single instruction file is injected
+const maxInstructionFileSize = 32 * 1024
+
+// InstructionFile is a project or user instruction file added to the system prompt
+type InstructionFile struct {
+	Path      string
+	Content   string
+	Truncated bool
+	// Size is the length of the whole file, in bytes
+	Size int
+}
+
+// LoadInstructionFiles returns the instruction files that apply to the current
+// working directory, from the most general to the most specific: the user-global
+// file in the config directory, then GOCODE.md in the project root and in every
+// directory between the root and the working directory.
+func LoadInstructionFiles() ([]InstructionFile, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if dir, err := config.ConfigDir(); err == nil {
+		paths = append(paths, filepath.Join(dir, InstructionFileName))
+	}
+	for _, dir := range directoriesFromRoot(FindProjectRoot(cwd), cwd) {
+		paths = append(paths, filepath.Join(dir, InstructionFileName))
+	}
+
+	var files []InstructionFile
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			utils.LogWarning("Failed to read instruction file", "system", map[string]interface{}{
+				"path":  path,
+				"error": err.Error(),
+			})
+			continue
+		}
+
+		file := InstructionFile{Path: path, Content: strings.TrimSpace(string(content))}
+		file.Size = len(file.Content)
+		if len(file.Content) > maxInstructionFileSize {
+			file.Content = utils.TruncateText(file.Content, maxInstructionFileSize)
+			file.Truncated = true
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// formatInstructions renders the instruction files as a system prompt section
+func formatInstructions(files []InstructionFile) string {
+	if len(files) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n# Project instructions\n")
+	b.WriteString("The USER provided the following instructions. Later files are more specific and take precedence over earlier ones. Follow them strictly.\n")
+	for _, file := range files {
+		fmt.Fprintf(&b, "\n## %s\n%s\n", file.Path, file.Content)
+		if file.Truncated {
+			fmt.Fprintf(&b, "[truncated: only the first %d of %d bytes are included, read the file for the rest]\n", len(file.Content), file.Size)
+		}
+	}
+	return b.String()
+}
+
+// FindProjectRoot walks up from dir looking for a .git entry and falls back to
+// dir itself when none is found
+func FindProjectRoot(dir string) string {
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return current
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// directoriesFromRoot lists root and each directory below it down to dir
+func directoriesFromRoot(root, dir string) []string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return []string{dir}
+	}
+
+	dirs := []string{root}
+	if rel == "." {
+		return dirs
+	}
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		dirs = append(dirs, current)
+	}
+	return dirs
+}
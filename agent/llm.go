@@ -3,10 +3,13 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os/exec"
 	"time"
 
 	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/tracing"
 	"github.com/KacemMathlouthi/go-code/utils"
 	"github.com/openai/openai-go"
 )
@@ -26,11 +29,11 @@ func GetLlmResponse(user_prompt string) (string, error) {
 			openai.SystemMessage(systemPrompt),
 			openai.UserMessage(user_prompt),
 		},
-		Seed:  openai.Int(0),
-		Model: openai.ChatModelGPT4_1Mini,
+		Seed: openai.Int(0),
 	}
 
-	completion, err := client.Chat.Completions.New(ctx, param)
+	models := modelChain()
+	completion, _, err := createCompletion(ctx, client, param, models, 0)
 
 	if err != nil {
 		return "", err
@@ -39,9 +42,59 @@ func GetLlmResponse(user_prompt string) (string, error) {
 	return completion.Choices[0].Message.Content, nil
 }
 
-func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageParamUnion) (string, error) {
+// LoopConfig controls the multi-step tool calling loop
+type LoopConfig struct {
+	// MaxIterations is the number of LLM steps allowed before the agent has to
+	// ask for permission to keep going
+	MaxIterations int
+	// Continue is called once MaxIterations steps have been used. Returning true
+	// grants another MaxIterations steps; when nil the loop stops and asks the
+	// model for a final answer without tools.
+	Continue func(stepsUsed int) bool
+	// OnEvent receives tool activity events as they happen
+	OnEvent func(Event)
+	// ApproveDiff is asked before a file change is applied. When nil every
+	// change is applied without asking.
+	ApproveDiff func(path, diff string) bool
+	// ApproveTool is asked before a tool that changes the repository, such as
+	// git_commit, is run. When nil those tools run without asking.
+	ApproveTool func(toolName string, toolArgs map[string]string) bool
+	// Snapshot is called with the path of a file before write_file,
+	// delete_file or lsp_rename changes it. The change is not made when it
+	// fails.
+	Snapshot func(path string) error
+	// Check verifies the files changed by a tool call, its report is appended
+	// to the tool result so the model can fix what it broke. When nil no
+	// check is run.
+	Check func(paths []string) string
+	// Context carries the span of the turn and cancels the requests. When nil
+	// context.Background() is used.
+	Context context.Context
+}
+
+// approvalTools change the repository in ways the diff preview doesn't cover,
+// so they go through LoopConfig.ApproveTool
+var approvalTools = map[string]bool{
+	"git_commit": true,
+	"lsp_rename": true,
+}
+
+// fileChangeTools are snapshotted through LoopConfig.Snapshot before they run
+var fileChangeTools = map[string]bool{
+	"write_file":  true,
+	"delete_file": true,
+}
+
+// maxRepeatedToolCalls is how many times the exact same tool call may be made
+// in one turn before the loop is considered stuck
+const maxRepeatedToolCalls = 3
+
+func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageParamUnion, loop LoopConfig) (string, error) {
 	client := config.GetOpenAIClient()
-	ctx := context.Background()
+	ctx := loop.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
 
 	// Get system prompt
 	systemPrompt, err := GetSystemPrompt()
@@ -57,42 +110,68 @@ func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageP
 	// Add conversation history (which should already include the current user message)
 	messages = append(messages, conversationHistory...)
 
+	tools := utils.AvailableTools()
 	params := openai.ChatCompletionNewParams{
 		Messages: messages,
-		Tools:    utils.ToolsDefinitions,
-		Model:    openai.ChatModelGPT4_1Mini,
+		Tools:    tools,
 	}
 
+	// Primary deployment followed by the configured fallbacks
+	models := modelChain()
+	modelIndex := 0
+
 	// Log the start of tool-enabled LLM request
 	utils.LogInfo("Starting tool-enabled LLM request", "llm", map[string]interface{}{
-		"model":               string(openai.ChatModelGPT4_1Mini),
+		"model":               models[0],
+		"fallback_models":     models[1:],
 		"conversation_length": len(conversationHistory),
-		"tools_available":     len(utils.ToolsDefinitions),
+		"tools_available":     len(tools),
 	})
 
+	maxIterations := loop.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = config.DefaultMaxIterations
+	}
+
 	// Multi-step tool calling loop
-	maxIterations := 10 // Prevent infinite loops
-	for iteration := 0; iteration < maxIterations; iteration++ {
+	iterationLimit := maxIterations
+	toolCallCounts := map[string]int{}
+	stopReason := "max_iterations"
+	iteration := 0
+	for ; ; iteration++ {
+		if iteration >= iterationLimit {
+			if loop.Continue == nil || !loop.Continue(iteration) {
+				break
+			}
+			iterationLimit += maxIterations
+			utils.LogInfo("User extended the iteration limit", "llm", map[string]interface{}{
+				"iterations_used": iteration,
+				"max_iterations":  iterationLimit,
+			})
+		}
+
 		utils.LogDebug("LLM iteration", "llm", map[string]interface{}{
 			"iteration":      iteration + 1,
-			"max_iterations": maxIterations,
+			"max_iterations": iterationLimit,
 		})
 
-		// Make chat completion request
-		start := time.Now()
-		completion, err := client.Chat.Completions.New(ctx, params)
-		duration := time.Since(start)
-
+		// Make chat completion request, falling back to the next model on failure
+		iterationCtx, iterationSpan := tracing.Start(ctx, "agent.iteration", tracing.KindInternal, map[string]interface{}{
+			"llm.iteration": iteration + 1,
+		})
+		completion, usedIndex, err := createCompletion(iterationCtx, client, params, models, modelIndex)
 		if err != nil {
 			utils.LogError("LLM request failed in iteration", "llm", map[string]interface{}{
 				"iteration": iteration + 1,
+				"model":     models[usedIndex],
 				"error":     err.Error(),
 			})
+			iterationSpan.SetError(err)
+			iterationSpan.Finish()
 			return "", err
 		}
-
-		// Log LLM response
-		utils.LogLLMResponse(completion.Choices[0].Message.Content, string(openai.ChatModelGPT4_1Mini), duration)
+		modelIndex = usedIndex
+		loop.emitUsage(iteration+1, models[modelIndex], completion)
 
 		// Add the assistant's response to the conversation
 		params.Messages = append(params.Messages, completion.Choices[0].Message.ToParam())
@@ -101,8 +180,10 @@ func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageP
 
 		// If there are no tool calls, we're done
 		if len(toolCalls) == 0 {
+			iterationSpan.Finish()
 			utils.LogInfo("LLM completed without tool calls", "llm", map[string]interface{}{
 				"iterations_used": iteration + 1,
+				"model":           models[modelIndex],
 			})
 			return completion.Choices[0].Message.Content, nil
 		}
@@ -113,7 +194,24 @@ func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageP
 		})
 
 		// Execute all tool calls in this iteration
+		loopDetected := false
 		for i, toolCall := range toolCalls {
+			// Identical calls keep returning identical results, so a model that
+			// repeats itself is stuck rather than making progress
+			callKey := toolCall.Function.Name + "\x00" + toolCall.Function.Arguments
+			toolCallCounts[callKey]++
+			if toolCallCounts[callKey] > maxRepeatedToolCalls {
+				utils.LogWarning("Repeated identical tool call detected", "tool", map[string]interface{}{
+					"tool_name": toolCall.Function.Name,
+					"arguments": toolCall.Function.Arguments,
+					"count":     toolCallCounts[callKey],
+				})
+				loopDetected = true
+				params.Messages = append(params.Messages, openai.ToolMessage(
+					"Skipped: this exact tool call was already made in this turn, reuse its previous result.", toolCall.ID))
+				continue
+			}
+
 			utils.LogDebug("Processing tool call", "tool", map[string]interface{}{
 				"iteration":  iteration + 1,
 				"tool_index": i + 1,
@@ -121,26 +219,95 @@ func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageP
 			})
 
 			// Parse tool arguments
-			var toolArgs map[string]string
-			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &toolArgs); err != nil {
+			toolArgs, err := parseToolArguments(toolCall.Function.Arguments)
+			if err != nil {
 				utils.LogError("Failed to parse tool arguments", "tool", map[string]interface{}{
 					"tool_name": toolCall.Function.Name,
 					"arguments": toolCall.Function.Arguments,
 					"error":     err.Error(),
 				})
+				iterationSpan.SetError(err)
+				iterationSpan.Finish()
 				return "", fmt.Errorf("failed to parse tool arguments: %v", err)
 			}
 
 			// Log tool call
 			utils.LogToolCall(toolCall.Function.Name, toolArgs)
 
+			// Preview file writes and let the user reject them
+			if toolCall.Function.Name == "write_file" && !previewFileWrite(loop, iteration+1, toolArgs) {
+				params.Messages = append(params.Messages, openai.ToolMessage(
+					fmt.Sprintf("The user rejected the change to %v, the file was not written.", toolArgs["path"]), toolCall.ID))
+				continue
+			}
+			if approvalTools[toolCall.Function.Name] && !approveToolCall(loop, toolCall.Function.Name, toolArgs) {
+				params.Messages = append(params.Messages, openai.ToolMessage(
+					fmt.Sprintf("The user rejected the %v call, nothing was changed.", toolCall.Function.Name), toolCall.ID))
+				continue
+			}
+
+			if fileChangeTools[toolCall.Function.Name] && loop.Snapshot != nil {
+				if err := loop.Snapshot(toolArgs["path"]); err != nil {
+					utils.LogError("Failed to checkpoint file", "tool", map[string]interface{}{
+						"tool_name": toolCall.Function.Name,
+						"path":      toolArgs["path"],
+						"error":     err.Error(),
+					})
+					params.Messages = append(params.Messages, openai.ToolMessage(
+						fmt.Sprintf("%v was not changed: its checkpoint could not be saved: %v", toolArgs["path"], err), toolCall.ID))
+					continue
+				}
+			}
+
 			// Execute the tool
+			loop.emit(Event{
+				Type:      EventToolStart,
+				Iteration: iteration + 1,
+				ToolName:  toolCall.Function.Name,
+				ToolArgs:  toolArgs,
+			})
+			// changed collects the files the tool writes, for the checks
+			var changed []string
+			if fileChangeTools[toolCall.Function.Name] {
+				changed = append(changed, toolArgs["path"])
+			}
+			beforeChange := func(path string) error {
+				if loop.Snapshot != nil {
+					if err := loop.Snapshot(path); err != nil {
+						return err
+					}
+				}
+				changed = append(changed, path)
+				return nil
+			}
+
+			_, toolSpan := tracing.Start(iterationCtx, "tool."+toolCall.Function.Name, tracing.KindInternal, toolSpanAttributes(toolCall.Function.Name, toolArgs))
 			toolStart := time.Now()
-			toolResult, err := utils.ExecuteTool(toolCall.Function.Name, toolArgs)
+			toolResult, err := utils.ExecuteTool(toolCall.Function.Name, toolArgs, beforeChange)
 			toolDuration := time.Since(toolStart)
+			traceToolResult(toolSpan, toolResult, err)
+			if err == nil && loop.Check != nil && len(changed) > 0 {
+				_, checkSpan := tracing.Start(iterationCtx, "tool.checks", tracing.KindInternal, map[string]interface{}{
+					"tool.name":    toolCall.Function.Name,
+					"checks.files": len(changed),
+				})
+				report := loop.Check(changed)
+				checkSpan.SetAttribute("checks.report_bytes", len(report))
+				checkSpan.Finish()
+				toolResult += report
+			}
+			loop.emit(Event{
+				Type:      EventToolEnd,
+				Iteration: iteration + 1,
+				ToolName:  toolCall.Function.Name,
+				ToolArgs:  toolArgs,
+				Result:    toolResult,
+				Err:       err,
+				Duration:  toolDuration,
+			})
 
 			// Log tool result
-			utils.LogToolResult(toolCall.Function.Name, toolResult, err)
+			utils.LogToolResult(toolCall.Function.Name, toolResult, err, toolDuration)
 			utils.LogDebug("Tool execution completed", "tool", map[string]interface{}{
 				"tool_name":   toolCall.Function.Name,
 				"duration":    toolDuration.String(),
@@ -152,6 +319,8 @@ func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageP
 					"tool_name": toolCall.Function.Name,
 					"error":     err.Error(),
 				})
+				iterationSpan.SetError(err)
+				iterationSpan.Finish()
 				return "", fmt.Errorf("failed to execute tool %s: %v", toolCall.Function.Name, err)
 			}
 
@@ -159,26 +328,132 @@ func GetLlmResponseWithTools(conversationHistory []openai.ChatCompletionMessageP
 			params.Messages = append(params.Messages, openai.ToolMessage(toolResult, toolCall.ID))
 		}
 
+		iterationSpan.Finish()
+		if loopDetected {
+			iteration++
+			stopReason = "repeated_tool_calls"
+			break
+		}
+
 		// Continue to next iteration to see if the LLM wants to make more tool calls
 	}
 
-	// If we've reached max iterations, make one final request without tools
-	utils.LogWarning("Reached max iterations, making final request without tools", "llm", map[string]interface{}{
-		"max_iterations": maxIterations,
+	// If we've reached max iterations or the model is stuck, make one final request without tools
+	utils.LogWarning("Stopping tool loop, making final request without tools", "llm", map[string]interface{}{
+		"reason":          stopReason,
+		"iterations_used": iteration,
+		"max_iterations":  iterationLimit,
 	})
 
 	params.Tools = nil
-	finalCompletion, err := client.Chat.Completions.New(ctx, params)
+	finalCompletion, finalIndex, err := createCompletion(ctx, client, params, models, modelIndex)
 	if err != nil {
 		utils.LogError("Final LLM request failed", "llm", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return "", err
 	}
+	loop.emitUsage(iteration+1, models[finalIndex], finalCompletion)
 
 	utils.LogInfo("LLM completed with max iterations", "llm", map[string]interface{}{
-		"iterations_used": maxIterations,
+		"iterations_used": iteration,
 	})
 
 	return finalCompletion.Choices[0].Message.Content, nil
 }
+
+// parseToolArguments decodes the arguments of a tool call. Strings are kept
+// as they are, null as an empty string and other values such as arrays as
+// their JSON text.
+func parseToolArguments(arguments string) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &raw); err != nil {
+		return nil, err
+	}
+	toolArgs := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var text string
+		if err := json.Unmarshal(value, &text); err != nil {
+			text = string(value)
+		}
+		toolArgs[key] = text
+	}
+	return toolArgs, nil
+}
+
+// toolSpanAttributes describes a tool call on its span. File contents are
+// left out, only their size is recorded.
+func toolSpanAttributes(name string, toolArgs map[string]string) map[string]interface{} {
+	attributes := map[string]interface{}{"tool.name": name}
+	for key, value := range toolArgs {
+		if key == "content" {
+			attributes["tool.args.content_bytes"] = len(value)
+			continue
+		}
+		attributes["tool.args."+key] = value
+	}
+	return attributes
+}
+
+// traceToolResult records the outcome of a tool call on its span
+func traceToolResult(span *tracing.Span, result string, err error) {
+	defer span.Finish()
+	span.SetAttribute("tool.output_bytes", len(result))
+	if err == nil {
+		span.SetAttribute("tool.status", "ok")
+		span.SetAttribute("tool.exit_code", 0)
+		return
+	}
+	span.SetAttribute("tool.status", "error")
+	span.SetError(err)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		span.SetAttribute("tool.exit_code", exitErr.ExitCode())
+	}
+}
+
+// approveToolCall asks the listener whether a mutating tool may run
+func approveToolCall(loop LoopConfig, toolName string, toolArgs map[string]string) bool {
+	if loop.ApproveTool == nil {
+		return true
+	}
+	approved := loop.ApproveTool(toolName, toolArgs)
+	utils.LogInfo("Tool call reviewed", "tool", map[string]interface{}{
+		"tool_name": toolName,
+		"approved":  approved,
+	})
+	return approved
+}
+
+// previewFileWrite computes the diff of a write_file call, logs it, shows it
+// to the listener and reports whether the write may proceed
+func previewFileWrite(loop LoopConfig, iteration int, toolArgs map[string]string) bool {
+	path := toolArgs["path"]
+	diff := utils.FileWriteDiff(path, toolArgs["content"])
+	added, removed := utils.DiffStats(diff)
+
+	utils.LogInfo("File diff", "tool", map[string]interface{}{
+		"path":    path,
+		"added":   added,
+		"removed": removed,
+		"diff":    diff,
+	})
+	loop.emit(Event{
+		Type:      EventFileDiff,
+		Iteration: iteration,
+		ToolName:  "write_file",
+		ToolArgs:  toolArgs,
+		Path:      path,
+		Diff:      diff,
+	})
+
+	if diff == "" || loop.ApproveDiff == nil {
+		return true
+	}
+	approved := loop.ApproveDiff(path, diff)
+	utils.LogInfo("File diff reviewed", "tool", map[string]interface{}{
+		"path":     path,
+		"approved": approved,
+	})
+	return approved
+}
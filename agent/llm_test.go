@@ -0,0 +1,30 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseToolArguments(t *testing.T) {
+	tests := []struct {
+		arguments string
+		want      map[string]string
+		wantErr   bool
+	}{
+		{arguments: `{"path": "main.go", "content": "package main\n"}`, want: map[string]string{"path": "main.go", "content": "package main\n"}},
+		{arguments: `{"paths": ["a.go", "my file.go"], "staged": true, "limit": 5}`, want: map[string]string{"paths": `["a.go", "my file.go"]`, "staged": "true", "limit": "5"}},
+		{arguments: `{"path": null}`, want: map[string]string{"path": ""}},
+		{arguments: `{}`, want: map[string]string{}},
+		{arguments: `not json`, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseToolArguments(test.arguments)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseToolArguments(%q) error = %v, want error %v", test.arguments, err, test.wantErr)
+			continue
+		}
+		if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseToolArguments(%q) = %q, want %q", test.arguments, got, test.want)
+		}
+	}
+}
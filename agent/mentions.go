@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+const (
+	// maxMentionFileSize caps the content attached for a single file
+	maxMentionFileSize = 100 * 1024
+	// maxMentionTotalSize caps the content attached to a single message
+	maxMentionTotalSize = 300 * 1024
+	// maxMentionDirEntries caps the entries listed for a directory
+	maxMentionDirEntries = 200
+)
+
+var mentionPattern = regexp.MustCompile(`(^|\s)@(\S+)`)
+
+// Attachment is a file or directory referenced with @path in the user input
+type Attachment struct {
+	Path      string
+	IsDir     bool
+	Size      int
+	Truncated bool
+	Skipped   string
+}
+
+// ExpandMentions appends the contents of files and the listings of
+// directories referenced as @path to the input. Mentions that don't match an
+// existing path are left untouched.
+func ExpandMentions(input string) (string, []Attachment) {
+	var attachments []Attachment
+	var blocks []string
+	seen := map[string]bool{}
+	total := 0
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(input, -1) {
+		path, info := resolveMention(match[2])
+		if info == nil || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		attachment := Attachment{Path: path, IsDir: info.IsDir()}
+		var block string
+		if info.IsDir() {
+			block = attachDirectory(&attachment, maxMentionTotalSize-total)
+		} else {
+			block = attachFile(&attachment, maxMentionTotalSize-total)
+		}
+		total += attachment.Size
+		attachments = append(attachments, attachment)
+		if block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+
+	if len(blocks) == 0 {
+		return input, attachments
+	}
+	return input + "\n\n" + strings.Join(blocks, "\n\n"), attachments
+}
+
+// resolveMention finds the path a mention refers to, ignoring trailing
+// punctuation such as "see @main.go."
+func resolveMention(mention string) (string, os.FileInfo) {
+	for candidate := mention; candidate != ""; candidate = candidate[:len(candidate)-1] {
+		if info, err := os.Stat(candidate); err == nil {
+			return candidate, info
+		}
+		if !strings.ContainsAny(candidate[len(candidate)-1:], ".,;:!?)]}'\"") {
+			break
+		}
+	}
+	return "", nil
+}
+
+func attachFile(attachment *Attachment, budget int) string {
+	content, err := os.ReadFile(attachment.Path)
+	if err != nil {
+		attachment.Skipped = err.Error()
+		return ""
+	}
+	if bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		attachment.Skipped = "binary file"
+		return ""
+	}
+
+	limit := min(maxMentionFileSize, budget)
+	if limit <= 0 {
+		attachment.Skipped = "attachment size limit reached"
+		return ""
+	}
+	text := string(content)
+	if len(text) > limit {
+		text = utils.TruncateText(text, limit)
+		attachment.Truncated = true
+	}
+	attachment.Size = len(text)
+
+	note := ""
+	if attachment.Truncated {
+		note = ` truncated="true"`
+	}
+	return fmt.Sprintf("<attached_file path=%q%s>\n%s\n</attached_file>", attachment.Path, note, strings.TrimRight(text, "\n"))
+}
+
+func attachDirectory(attachment *Attachment, budget int) string {
+	if budget <= 0 {
+		attachment.Skipped = "attachment size limit reached"
+		return ""
+	}
+	entries, err := os.ReadDir(attachment.Path)
+	if err != nil {
+		attachment.Skipped = err.Error()
+		return ""
+	}
+
+	var lines []string
+	for i, entry := range entries {
+		if i == maxMentionDirEntries {
+			lines = append(lines, fmt.Sprintf("... %d more entries", len(entries)-maxMentionDirEntries))
+			attachment.Truncated = true
+			break
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		lines = append(lines, name)
+	}
+	listing := strings.Join(lines, "\n")
+	if len(listing) > budget {
+		listing = utils.TruncateText(listing, budget)
+		attachment.Truncated = true
+	}
+	attachment.Size = len(listing)
+	return fmt.Sprintf("<attached_directory path=%q>\n%s\n</attached_directory>", attachment.Path, listing)
+}
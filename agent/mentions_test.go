@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func writeMentionFiles(t *testing.T, files map[string]string) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandMentions(t *testing.T) {
+	writeMentionFiles(t, map[string]string{
+		"main.go":   "package main\n",
+		"image.png": "\x89PNG\x00\x00",
+	})
+	if err := os.Mkdir("docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	input := "Fix @main.go, then compare (@main.go) with @docs and @image.png. Ignore @missing.go or me@example"
+	message, attachments := ExpandMentions(input)
+
+	if !strings.HasPrefix(message, input+"\n\n") {
+		t.Errorf("ExpandMentions() = %q, want the input first", message)
+	}
+	if strings.Count(message, `<attached_file path="main.go">`) != 1 || !strings.Contains(message, "package main") {
+		t.Errorf("ExpandMentions() = %q, want main.go attached once", message)
+	}
+	if !strings.Contains(message, `<attached_directory path="docs">`) {
+		t.Errorf("ExpandMentions() = %q, want the docs listing", message)
+	}
+	if len(attachments) != 3 || attachments[2].Path != "image.png" || attachments[2].Skipped != "binary file" {
+		t.Errorf("attachments = %+v, want main.go, docs and the skipped binary image.png", attachments)
+	}
+}
+
+func TestExpandMentionsLimits(t *testing.T) {
+	big := strings.Repeat("é", maxMentionFileSize)
+	wide := strings.Repeat("日", maxMentionFileSize)
+	writeMentionFiles(t, map[string]string{"a.txt": big, "b.txt": big, "c.txt": big, "d.txt": big, "wide.txt": wide})
+
+	_, attachments := ExpandMentions("@a.txt @b.txt @c.txt @d.txt")
+	total := 0
+	for _, attachment := range attachments[:3] {
+		if !attachment.Truncated || attachment.Size > maxMentionFileSize {
+			t.Errorf("attachment %s = %+v, want it truncated to %d bytes", attachment.Path, attachment, maxMentionFileSize)
+		}
+		total += attachment.Size
+	}
+	if total > maxMentionTotalSize {
+		t.Errorf("attached %d bytes, want at most %d", total, maxMentionTotalSize)
+	}
+	if last := attachments[3]; last.Skipped != "attachment size limit reached" {
+		t.Errorf("attachment %s = %+v, want it skipped once the total budget is used", last.Path, last)
+	}
+
+	message, _ := ExpandMentions("@wide.txt")
+	if !utf8.ValidString(message) || !strings.Contains(message, `truncated="true"`) {
+		t.Errorf("ExpandMentions() cut a character in half or lost the truncation note")
+	}
+}
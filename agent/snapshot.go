@@ -0,0 +1,348 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+const (
+	// snapshotBudget is the hard limit, in characters, of the project snapshot
+	snapshotBudget = 6000
+	// snapshotTreeDepth is how many directory levels the snapshot tree shows
+	snapshotTreeDepth = 3
+	// snapshotDirEntries caps the entries listed per directory
+	snapshotDirEntries = 25
+	// snapshotMaxFiles stops the file listing in huge trees
+	snapshotMaxFiles = 20000
+)
+
+// sessionSnapshot is the project snapshot of the session, built once for its
+// directory and reused by every system prompt
+var sessionSnapshot struct {
+	dir      string
+	snapshot string
+}
+
+// ProjectSnapshot returns the snapshot of dir, built at its first use in the
+// session
+func ProjectSnapshot(dir string) string {
+	if sessionSnapshot.snapshot == "" || sessionSnapshot.dir != dir {
+		sessionSnapshot.dir = dir
+		sessionSnapshot.snapshot = BuildProjectSnapshot(dir)
+	}
+	return sessionSnapshot.snapshot
+}
+
+// ResetProjectSnapshot makes the next ProjectSnapshot build a fresh snapshot
+func ResetProjectSnapshot() {
+	sessionSnapshot.snapshot = ""
+}
+
+// buildFiles are well known files that reveal how a project is built
+var buildFiles = []string{
+	"go.mod", "go.work", "package.json", "Makefile", "Cargo.toml", "pyproject.toml",
+	"requirements.txt", "setup.py", "pom.xml", "build.gradle", "build.gradle.kts",
+	"CMakeLists.txt", "Gemfile", "composer.json", "Dockerfile", "docker-compose.yml",
+}
+
+// languageExtensions maps file extensions to language names
+var languageExtensions = map[string]string{
+	".go": "Go", ".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".py": "Python", ".rs": "Rust",
+	".java": "Java", ".kt": "Kotlin", ".c": "C", ".h": "C", ".cc": "C++",
+	".cpp": "C++", ".hpp": "C++", ".cs": "C#", ".rb": "Ruby", ".php": "PHP",
+	".swift": "Swift", ".scala": "Scala", ".sh": "Shell", ".html": "HTML",
+	".css": "CSS", ".scss": "CSS", ".sql": "SQL", ".lua": "Lua", ".dart": "Dart",
+}
+
+// BuildProjectSnapshot describes the project containing dir: its root, build
+// files, languages, git status and a depth-limited tree that honors .gitignore.
+// The result never exceeds snapshotBudget characters.
+func BuildProjectSnapshot(dir string) string {
+	root := FindProjectRoot(dir)
+	files, isGit := listProjectFiles(root)
+
+	var header strings.Builder
+	fmt.Fprintf(&header, "Project root: %s\n", root)
+	if rel, err := filepath.Rel(root, dir); err == nil && rel != "." {
+		fmt.Fprintf(&header, "Working directory relative to root: %s\n", rel)
+	}
+	if found := detectBuildFiles(root); len(found) > 0 {
+		fmt.Fprintf(&header, "Build files: %s\n", strings.Join(found, ", "))
+	}
+	if languages := detectLanguages(files); len(languages) > 0 {
+		fmt.Fprintf(&header, "Languages: %s\n", strings.Join(languages, ", "))
+	}
+	if isGit {
+		if status := gitStatusSummary(root); status != "" {
+			fmt.Fprintf(&header, "Git status: %s\n", status)
+		}
+	}
+	if len(files) >= snapshotMaxFiles {
+		fmt.Fprintf(&header, "Files: at least %d, only those are shown\n", snapshotMaxFiles)
+	} else {
+		fmt.Fprintf(&header, "Files: %d\n", len(files))
+	}
+	fmt.Fprintf(&header, "\nTree (depth %d):\n", snapshotTreeDepth)
+
+	snapshot := header.String() + renderFileTree(files)
+	if len(snapshot) > snapshotBudget {
+		const marker = "\n[snapshot truncated]"
+		snapshot = utils.TruncateText(snapshot, snapshotBudget-len(marker)) + marker
+	}
+	return snapshot
+}
+
+// listProjectFiles returns at most snapshotMaxFiles project files relative to
+// root. Inside a git repository git itself applies the ignore rules; elsewhere
+// the root .gitignore is honored on a best effort basis.
+func listProjectFiles(root string) ([]string, bool) {
+	if files, ok := listGitFiles(root); ok {
+		return files, true
+	}
+
+	patterns := readGitignore(root)
+	var files []string
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, path)
+		if strings.HasPrefix(d.Name(), ".") || isIgnored(rel, d.IsDir(), patterns) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		if len(files) >= snapshotMaxFiles {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return files, false
+}
+
+// listGitFiles reads the tracked and untracked, not ignored, files from git as
+// they are listed and stops git once snapshotMaxFiles are read
+func listGitFiles(root string) ([]string, bool) {
+	cmd := exec.Command("git", "-C", root, "-c", "core.quotepath=off", "ls-files", "--cached", "--others", "--exclude-standard")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, false
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, false
+	}
+
+	var files []string
+	scanner := bufio.NewScanner(stdout)
+	for len(files) < snapshotMaxFiles && scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			files = append(files, line)
+		}
+	}
+	capped := len(files) >= snapshotMaxFiles
+	if capped {
+		cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil && !capped {
+		return nil, false
+	}
+	sort.Strings(files)
+	return files, true
+}
+
+// readGitignore loads the non-negated patterns of root/.gitignore
+func readGitignore(root string) []string {
+	file, err := os.Open(filepath.Join(root, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns
+}
+
+// isIgnored matches a relative path against simple gitignore patterns
+func isIgnored(rel string, isDir bool, patterns []string) bool {
+	rel = filepath.ToSlash(rel)
+	name := filepath.Base(rel)
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		if strings.HasPrefix(pattern, "/") {
+			if ok, _ := filepath.Match(strings.TrimPrefix(pattern, "/"), rel); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// detectBuildFiles lists the known build files present in root
+func detectBuildFiles(root string) []string {
+	var found []string
+	for _, name := range buildFiles {
+		if _, err := os.Stat(filepath.Join(root, name)); err == nil {
+			found = append(found, name)
+		}
+	}
+	return found
+}
+
+// detectLanguages returns the languages used in the project, most common first
+func detectLanguages(files []string) []string {
+	counts := map[string]int{}
+	for _, file := range files {
+		if language, ok := languageExtensions[strings.ToLower(filepath.Ext(file))]; ok {
+			counts[language]++
+		}
+	}
+
+	languages := make([]string, 0, len(counts))
+	for language := range counts {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		if counts[languages[i]] != counts[languages[j]] {
+			return counts[languages[i]] > counts[languages[j]]
+		}
+		return languages[i] < languages[j]
+	})
+
+	if len(languages) > 6 {
+		languages = languages[:6]
+	}
+	for i, language := range languages {
+		languages[i] = fmt.Sprintf("%s (%d files)", language, counts[language])
+	}
+	return languages
+}
+
+// gitStatusSummary condenses `git status` into the branch and change counts
+func gitStatusSummary(root string) string {
+	out, err := exec.Command("git", "-C", root, "status", "--porcelain=v1", "--branch").Output()
+	if err != nil {
+		return ""
+	}
+
+	branch := ""
+	modified, added, deleted, untracked := 0, 0, 0, 0
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) < 3 {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "## "):
+			branch = strings.TrimPrefix(line, "## ")
+		case strings.HasPrefix(line, "??"):
+			untracked++
+		case strings.ContainsRune(line[:2], 'D'):
+			deleted++
+		case strings.ContainsRune(line[:2], 'A'):
+			added++
+		default:
+			modified++
+		}
+	}
+
+	if modified+added+deleted+untracked == 0 {
+		return fmt.Sprintf("%s, clean", branch)
+	}
+	return fmt.Sprintf("%s, %d modified, %d added, %d deleted, %d untracked", branch, modified, added, deleted, untracked)
+}
+
+// treeNode is a directory in the snapshot tree
+type treeNode struct {
+	dirs  map[string]*treeNode
+	files []string
+	count int
+}
+
+// renderFileTree draws the files as a tree limited to snapshotTreeDepth levels
+func renderFileTree(files []string) string {
+	root := &treeNode{dirs: map[string]*treeNode{}}
+	for _, file := range files {
+		node := root
+		parts := strings.Split(file, "/")
+		for _, part := range parts[:len(parts)-1] {
+			node.count++
+			child, ok := node.dirs[part]
+			if !ok {
+				child = &treeNode{dirs: map[string]*treeNode{}}
+				node.dirs[part] = child
+			}
+			node = child
+		}
+		node.count++
+		node.files = append(node.files, parts[len(parts)-1])
+	}
+
+	var b strings.Builder
+	writeTreeNode(&b, root, "", 1)
+	return b.String()
+}
+
+func writeTreeNode(b *strings.Builder, node *treeNode, indent string, depth int) {
+	dirs := make([]string, 0, len(node.dirs))
+	for name := range node.dirs {
+		dirs = append(dirs, name)
+	}
+	sort.Strings(dirs)
+
+	shown := 0
+	for _, name := range dirs {
+		if shown == snapshotDirEntries {
+			break
+		}
+		child := node.dirs[name]
+		if depth >= snapshotTreeDepth {
+			fmt.Fprintf(b, "%s%s/ (%d files)\n", indent, name, child.count)
+		} else {
+			fmt.Fprintf(b, "%s%s/\n", indent, name)
+			writeTreeNode(b, child, indent+"  ", depth+1)
+		}
+		shown++
+	}
+	for _, name := range node.files {
+		if shown == snapshotDirEntries {
+			break
+		}
+		fmt.Fprintf(b, "%s%s\n", indent, name)
+		shown++
+	}
+
+	if hidden := len(dirs) + len(node.files) - shown; hidden > 0 {
+		fmt.Fprintf(b, "%s... %d more entries\n", indent, hidden)
+	}
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRenderFileTree(t *testing.T) {
+	files := []string{"go.mod", "cmd/root.go", "a/b/c/d/deep.go", "a/b/c/e.go"}
+	for i := 0; i < snapshotDirEntries+5; i++ {
+		files = append(files, fmt.Sprintf("many/file%02d.go", i))
+	}
+
+	tree := renderFileTree(files)
+	if !strings.Contains(tree, "    c/ (2 files)\n") || strings.Contains(tree, "deep.go") {
+		t.Errorf("renderFileTree() = %q, want directories below depth %d collapsed", tree, snapshotTreeDepth)
+	}
+	if !strings.Contains(tree, "  ... 5 more entries\n") || strings.Contains(tree, "file29.go") {
+		t.Errorf("renderFileTree() = %q, want at most %d entries per directory", tree, snapshotDirEntries)
+	}
+}
+
+func TestListProjectFilesHonorsGitignore(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".gitignore":    "build/\n",
+		"main.go":       "package main\n",
+		"build/out.bin": "",
+		"docs/é.md":     "",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out, err := exec.Command("git", "-C", root, "init", "-q").CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, out)
+	}
+
+	files, isGit := listProjectFiles(root)
+	want := []string{".gitignore", "docs/é.md", "main.go"}
+	if !isGit || !reflect.DeepEqual(files, want) {
+		t.Errorf("listProjectFiles() = %q, %v, want %q from git", files, isGit, want)
+	}
+}
+
+func TestBuildProjectSnapshotBudget(t *testing.T) {
+	root := t.TempDir()
+	name := strings.Repeat("é", 60)
+	for i := 0; i < 20; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("%s%02d", name, i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < 20; j++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%s%02d.go", name, j)), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	snapshot := BuildProjectSnapshot(root)
+	if len(snapshot) > snapshotBudget || !utf8.ValidString(snapshot) || !strings.HasSuffix(snapshot, "[snapshot truncated]") {
+		t.Errorf("BuildProjectSnapshot() = %d bytes, valid UTF-8 %v, want at most %d and a truncation marker",
+			len(snapshot), utf8.ValidString(snapshot), snapshotBudget)
+	}
+}
+
+func TestProjectSnapshotIsCached(t *testing.T) {
+	root := t.TempDir()
+	defer ResetProjectSnapshot()
+	ResetProjectSnapshot()
+
+	first := ProjectSnapshot(root)
+	if err := os.WriteFile(filepath.Join(root, "added.go"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := ProjectSnapshot(root); got != first {
+		t.Errorf("ProjectSnapshot() was rebuilt within the session")
+	}
+	ResetProjectSnapshot()
+	if got := ProjectSnapshot(root); !strings.Contains(got, "added.go") {
+		t.Errorf("ProjectSnapshot() after a reset = %q, want the new file", got)
+	}
+}
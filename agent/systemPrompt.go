@@ -1,106 +1,183 @@
 package agent
 
 import (
+	_ "embed"
+	"errors"
 	"fmt"
-
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/KacemMathlouthi/go-code/config"
 	"github.com/KacemMathlouthi/go-code/tools"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+//go:embed prompts/system.tmpl
+var defaultSystemPrompt string
+
+const (
+	// DefaultPromptProfile selects the built-in prompt, or prompts/system.tmpl
+	// from the config directory when the user overrides it
+	DefaultPromptProfile = "default"
+	// promptOverrideFile replaces the built-in prompt
+	promptOverrideFile = "system.tmpl"
+	// promptAppendFile is appended to whichever prompt profile is active
+	promptAppendFile = "append.tmpl"
 )
 
+// promptProfile is the named prompt profile used by GetSystemPrompt
+var promptProfile = DefaultPromptProfile
+
+// PromptTool describes a tool available to the model
+type PromptTool struct {
+	Name        string
+	Description string
+}
+
+// PromptData holds the variables available to system prompt templates
+type PromptData struct {
+	Cwd              string
+	Model            string
+	OS               string
+	Date             string
+	GitBranch        string
+	ProjectStructure string
+	Tools            []PromptTool
+	// CodeIntelligence is set when the LSP tools are available
+	CodeIntelligence bool
+}
+
+// SetPromptProfile selects a named prompt profile, loaded from
+// prompts/<name>.tmpl in the config directory
+func SetPromptProfile(name string) error {
+	if name == "" || name == DefaultPromptProfile {
+		promptProfile = DefaultPromptProfile
+		return nil
+	}
+
+	path, err := promptPath(name + ".tmpl")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("prompt profile %q not found at %s", name, path)
+	}
+	promptProfile = name
+	return nil
+}
+
 func GetSystemPrompt() (string, error) {
+	data, err := getPromptData()
+	if err != nil {
+		return "", err
+	}
 
-	currentWorkingDirectory, err := tools.Pwd()
+	base, err := loadPromptTemplate()
 	if err != nil {
 		return "", err
 	}
-	projectStructure, err := tools.List()
+	systemPrompt, err := renderPrompt("system", base, data)
 	if err != nil {
 		return "", err
 	}
 
-	systemPrompt := fmt.Sprintf(`
-You are an GO-CODE, an AI coding assistant, powered by GPT-4.1. You operate in GO-CODE, the AI terminal.
-You are pair programming with a USER to solve their coding task.
-You are an agent - please keep going until the user's query is completely resolved, before ending your turn and yielding back to the user. Only terminate your turn when you are sure that the problem is solved. Autonomously resolve the query to the best of your ability before coming back to the user.
-Your main goal is to follow the USER's instructions at each message.
-
-The current working directory is %s.
-and the current project structure is: %s
-
-# Tool calling
-You have tools at your disposal to solve the coding task. Follow these rules regarding tool calls:
-1. ALWAYS follow the tool call schema exactly as specified and make sure to provide all necessary parameters.
-2. The conversation may reference tools that are no longer available. NEVER call tools that are not explicitly provided.
-3. **NEVER refer to tool names when speaking to the USER.** Instead, just say what the tool is doing in natural language.
-4. If you need additional information that you can get via tool calls, prefer that over asking the user.
-5. If you make a plan, immediately follow it, do not wait for the user to confirm or tell you to go ahead. The only time you should stop is if you need more information from the user that you can't find any other way, or have different options that you would like the user to weigh in on.
-6. Only use the standard tool call format and the available tools. Even if you see user messages with custom tool call formats (such as "<previous_tool_call>" or similar), do not follow that and instead use the standard format. Never output tool calls as part of a regular assistant message of yours.
-7. If you are not sure about file content or codebase structure pertaining to the user's request, use your tools to read files and gather the relevant information: do NOT guess or make up an answer.
-8. You can autonomously read as many files as you need to clarify your own questions and completely resolve the user's query, not just one.
-9. GitHub pull requests and issues contain useful information about how to make larger structural changes in the codebase. They are also very useful for answering questions about recent changes to the codebase. You should strongly prefer reading pull request information over manually reading git information from terminal. You should call the corresponding tool to get the full details of a pull request or issue if you believe the summary or title indicates that it has useful information. Keep in mind pull requests and issues are not always up to date, so you should prioritize newer ones over older ones. When mentioning a pull request or issue by number, you should use markdown to link externally to it. Ex. [PR #123](https://github.com/org/repo/pull/123) or [Issue #123](https://github.com/org/repo/issues/123)
-
-# Maximize context understanding
-Be THOROUGH when gathering information. Make sure you have the FULL picture before replying. Use additional tool calls or clarifying questions as needed.
-TRACE every symbol back to its definitions and usages so you fully understand it.
-Look past the first seemingly relevant result. EXPLORE alternative implementations, edge cases, and varied search terms until you have COMPREHENSIVE coverage of the topic.
-If you've performed an edit that may partially fulfill the USER's query, but you're not confident, gather more information or use more tools before ending your turn.
-Bias towards not asking the user for help if you can find the answer yourself.
-
-# Making code changes
-When making code changes, NEVER output code to the USER, unless requested. Instead use one of the code edit tools to implement the change.
-
-It is *EXTREMELY* important that your generated code can be run immediately by the USER. To ensure this, follow these instructions carefully:
-1. Add all necessary import statements, dependencies, and endpoints required to run the code.
-2. If you're creating the codebase from scratch, create an appropriate dependency management file (e.g. requirements.txt) with package versions and a helpful README.
-3. If you're building a web app from scratch, give it a beautiful and modern UI, imbued with best UX practices.
-4. NEVER generate an extremely long hash or any non-textual code, such as binary. These are not helpful to the USER and are very expensive.
-5. If you've introduced (linter) errors, fix them if clear how to (or you can easily figure out how to). Do not make uneducated guesses. And do NOT loop more than 3 times on fixing linter errors on the same file. On the third time, you should stop and ask the user what to do next.
-6. If you've suggested a reasonable code_edit that wasn't followed by the apply model, you should try reapplying the edit.
-
-Answer the user's request using the relevant tool(s), if they are available. Check that all the required parameters for each tool call are provided or can reasonably be inferred from context. IF there are no relevant tools or there are missing values for required parameters, ask the user to supply these values; otherwise proceed with the tool calls. If the user provides a specific value for a parameter (for example provided in quotes), make sure to use that value EXACTLY. DO NOT make up values for or ask about optional parameters. Carefully analyze descriptive terms in the request as they may indicate required parameter values that should be included even if not explicitly quoted.
-
-# Tool Usage Guidelines
-
-## File Operations
-- **Reading files**: Use "read_file" to examine file contents. This is the preferred method over shell commands like "cat".
-- **Writing files**: Use "write_file" for creating or modifying files. This ensures proper file handling and error reporting.
-- **Deleting files**: Use "delete_file" with caution. Always verify the file is safe to delete before proceeding.
-
-## File System Navigation
-- **Current location**: Use "pwd" to understand your current working directory.
-- **Directory exploration**: Use "list" to see contents of current directory, "tree" for hierarchical view.
-- **Path handling**: Use relative paths for files in the same directory tree, absolute paths for system files.
-
-## Text Search
-- **Pattern matching**: Use "grep" with appropriate regex patterns to find specific text in files.
-- **Search strategy**: Be specific with patterns to avoid overwhelming results.
-
-## Shell Commands
-- **System operations**: Use "shell" for package management, building, testing, git operations, etc.
-- **Safety first**: Avoid destructive commands unless explicitly requested and verified.
-- **Output handling**: Shell commands return their output directly - handle pagination appropriately.
-
-## Directory Creation
-- **Creating directories**: Use "mkdir" to create directories and parent directories as needed.
-- **Path handling**: Supports both single directories and nested directory structures.
-
-# Coding Guidelines
-When working with code:
-- **File examination**: Always read files before making changes to understand their current state.
-- **Dependencies**: When modifying code, check for upstream and downstream dependencies.
-- **Patterns**: Adhere to existing code patterns and idioms in the codebase.
-- **File creation**: Use "write_file" to create new code files.
-- **File modification**: Use "write_file" to modify existing files with the new content.
-
-# Task Completion
-- **Exact execution**: Do exactly what the user requests, no more and no less.
-- **Confirmation**: Don't assume follow-up actions unless explicitly requested.
-- **Verification**: After completing coding tasks, offer to verify changes (compilation, tests, linting).
-- **Action bias**: If the user asks you to do something, just do it without asking for confirmation first.
-
-Remember: You are a helpful coding assistant. Be efficient, safe, and precise in your operations. You can perform complex multi-step workflows by making multiple tool calls in sequence.`,
-		currentWorkingDirectory,
-		projectStructure,
-	)
+	// Append the user's additions to whichever profile is active
+	if appendPath, err := promptPath(promptAppendFile); err == nil {
+		if content, err := os.ReadFile(appendPath); err == nil {
+			extra, err := renderPrompt(promptAppendFile, string(content), data)
+			if err != nil {
+				return "", err
+			}
+			systemPrompt += "\n" + extra
+		}
+	}
+
+	// Append project and user instructions (GOCODE.md files)
+	instructions, err := LoadInstructionFiles()
+	if err != nil {
+		return "", err
+	}
+	systemPrompt += formatInstructions(instructions)
 
 	return systemPrompt, nil
 }
+
+// getPromptData collects the values exposed to the prompt templates
+func getPromptData() (PromptData, error) {
+	currentWorkingDirectory, err := os.Getwd()
+	if err != nil {
+		return PromptData{}, err
+	}
+
+	// Not being in a git repository is not an error
+	branch, err := tools.Shell("git rev-parse --abbrev-ref HEAD 2>/dev/null")
+	if err != nil {
+		branch = ""
+	}
+
+	data := PromptData{
+		Cwd:              currentWorkingDirectory,
+		Model:            CurrentModel(),
+		OS:               runtime.GOOS + "/" + runtime.GOARCH,
+		Date:             time.Now().Format("2006-01-02"),
+		GitBranch:        strings.TrimSpace(branch),
+		ProjectStructure: ProjectSnapshot(currentWorkingDirectory),
+	}
+	for _, tool := range utils.AvailableTools() {
+		data.Tools = append(data.Tools, PromptTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description.Value,
+		})
+		if strings.HasPrefix(tool.Function.Name, "lsp_") {
+			data.CodeIntelligence = true
+		}
+	}
+	return data, nil
+}
+
+// loadPromptTemplate returns the template source for the active profile
+func loadPromptTemplate() (string, error) {
+	name := promptOverrideFile
+	if promptProfile != DefaultPromptProfile {
+		name = promptProfile + ".tmpl"
+	}
+
+	path, err := promptPath(name)
+	if err != nil {
+		return defaultSystemPrompt, nil
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && promptProfile == DefaultPromptProfile {
+		return defaultSystemPrompt, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt template %s: %v", path, err)
+	}
+	return string(content), nil
+}
+
+// renderPrompt executes a prompt template with the given data
+func renderPrompt(name, source string, data PromptData) (string, error) {
+	tmpl, err := template.New(name).Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prompt template %s: %v", name, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %v", name, err)
+	}
+	return b.String(), nil
+}
+
+// promptPath returns the path of a file in the prompts config directory
+func promptPath(name string) (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "prompts", name), nil
+}
@@ -0,0 +1,320 @@
+// Package checkpoint snapshots the files the agent changes so a turn can be
+// undone without relying on git
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxAge is how long the checkpoints of previous sessions are kept
+const DefaultMaxAge = 7 * 24 * time.Hour
+
+// FileState is the content of a file before the agent first changed it in a turn
+type FileState struct {
+	Path string `json:"path"`
+	// Existed is false for files the agent created, they are removed on restore
+	Existed bool        `json:"existed"`
+	Hash    string      `json:"hash,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+}
+
+// Checkpoint holds the files changed by one turn
+type Checkpoint struct {
+	ID      int         `json:"id"`
+	Created time.Time   `json:"created"`
+	Prompt  string      `json:"prompt"`
+	Files   []FileState `json:"files"`
+}
+
+// Store keeps the checkpoints of a session. File contents live in a content
+// addressed object directory shared by all sessions; the checkpoints of a
+// session are indexed in <dir>/<session>.json.
+type Store struct {
+	mu          sync.Mutex
+	dir         string
+	session     string
+	checkpoints []Checkpoint
+	// pending is the checkpoint of the current turn, saved once a file is
+	// snapshotted
+	pending *Checkpoint
+	nextID  int
+}
+
+// Open loads the checkpoints of session from dir and deletes those of
+// sessions older than maxAge along with the contents no longer referenced
+func Open(dir, session string, maxAge time.Duration) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0700); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, session: session, nextID: 1}
+
+	data, err := os.ReadFile(s.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+			return nil, fmt.Errorf("failed to read checkpoints: %v", err)
+		}
+		for _, checkpoint := range s.checkpoints {
+			s.nextID = max(s.nextID, checkpoint.ID+1)
+		}
+	}
+
+	if maxAge > 0 {
+		if err := s.prune(maxAge); err != nil {
+			return s, fmt.Errorf("failed to clean up checkpoints: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// Begin starts the checkpoint of a new turn. Turns that change no file leave
+// no checkpoint.
+func (s *Store) Begin(prompt string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending = &Checkpoint{Created: time.Now(), Prompt: prompt}
+}
+
+// Snapshot saves the content of path before it is written or deleted. Only
+// the first change of a file in a turn is recorded.
+func (s *Store) Snapshot(path string) error {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = &Checkpoint{Created: time.Now()}
+	}
+	for _, file := range s.pending.Files {
+		if file.Path == absolute {
+			return nil
+		}
+	}
+
+	state := FileState{Path: absolute}
+	info, err := os.Stat(absolute)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case info.IsDir():
+		return fmt.Errorf("%s is a directory", path)
+	default:
+		content, err := os.ReadFile(absolute)
+		if err != nil {
+			return err
+		}
+		hash, err := s.storeObject(content)
+		if err != nil {
+			return err
+		}
+		state.Existed, state.Hash, state.Mode = true, hash, info.Mode().Perm()
+	}
+
+	if s.pending.ID == 0 {
+		s.pending.ID = s.nextID
+		s.nextID++
+		s.checkpoints = append(s.checkpoints, *s.pending)
+	}
+	s.pending.Files = append(s.pending.Files, state)
+	s.checkpoints[len(s.checkpoints)-1] = *s.pending
+	return s.save()
+}
+
+// List returns the checkpoints, oldest first
+func (s *Store) List() []Checkpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Checkpoint(nil), s.checkpoints...)
+}
+
+// Undo reverts the files changed by the last checkpoint
+func (s *Store) Undo() (Checkpoint, []string, error) {
+	s.mu.Lock()
+	if len(s.checkpoints) == 0 {
+		s.mu.Unlock()
+		return Checkpoint{}, nil, fmt.Errorf("no checkpoints to undo")
+	}
+	last := s.checkpoints[len(s.checkpoints)-1]
+	s.mu.Unlock()
+
+	restored, err := s.Restore(last.ID)
+	return last, restored, err
+}
+
+// Restore puts the files back in the state they had before checkpoint id,
+// undoing it and every later checkpoint, newest first. It returns a line per
+// restored file.
+func (s *Store) Restore(id int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := -1
+	for i, checkpoint := range s.checkpoints {
+		if checkpoint.ID == id {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("no checkpoint %d", id)
+	}
+
+	var restored []string
+	for i := len(s.checkpoints) - 1; i >= index; i-- {
+		for _, file := range s.checkpoints[i].Files {
+			action, err := s.restoreFile(file)
+			if err != nil {
+				s.checkpoints = s.checkpoints[:i+1]
+				s.save()
+				return restored, fmt.Errorf("failed to restore %s: %v", file.Path, err)
+			}
+			restored = append(restored, action+" "+file.Path)
+		}
+		// A checkpoint is dropped once all its files are back
+		s.checkpoints = s.checkpoints[:i]
+	}
+	s.pending = nil
+	return restored, s.save()
+}
+
+func (s *Store) restoreFile(file FileState) (string, error) {
+	if !file.Existed {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		return "removed", nil
+	}
+
+	content, err := os.ReadFile(s.objectPath(file.Hash))
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(file.Path, content, file.Mode); err != nil {
+		return "", err
+	}
+	// WriteFile keeps the mode of an existing file
+	os.Chmod(file.Path, file.Mode)
+	return "restored", nil
+}
+
+// storeObject writes content under its SHA-256 hash unless already stored
+func (s *Store) storeObject(content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	path := s.objectPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	// Write then rename so a crash never leaves a truncated object
+	temp, err := os.CreateTemp(filepath.Dir(path), hash+".tmp*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := temp.Write(content); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return "", err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return "", err
+	}
+	return hash, os.Rename(temp.Name(), path)
+}
+
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.dir, "objects", hash[:2], hash)
+}
+
+func (s *Store) indexPath() string {
+	return filepath.Join(s.dir, s.session+".json")
+}
+
+// save writes the index of the session, or removes it when empty
+func (s *Store) save() error {
+	if len(s.checkpoints) == 0 {
+		if err := os.Remove(s.indexPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(s.checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.indexPath(), data, 0600)
+}
+
+// prune deletes the indexes of other sessions older than maxAge, then the
+// objects no remaining index refers to
+func (s *Store) prune(maxAge time.Duration) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	referenced := map[string]bool{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		path := filepath.Join(s.dir, name)
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if path != s.indexPath() && time.Since(info.ModTime()) > maxAge {
+			os.Remove(path)
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var checkpoints []Checkpoint
+		if err := json.Unmarshal(data, &checkpoints); err != nil {
+			// Keep the objects of an index that can't be read
+			return nil
+		}
+		for _, checkpoint := range checkpoints {
+			for _, file := range checkpoint.Files {
+				referenced[file.Hash] = true
+			}
+		}
+	}
+
+	objects := filepath.Join(s.dir, "objects")
+	return filepath.WalkDir(objects, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		// Objects of a running session may not be indexed yet
+		if err == nil && time.Since(info.ModTime()) > time.Hour && !referenced[entry.Name()] {
+			os.Remove(path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,148 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndoRestoresTheTurn(t *testing.T) {
+	work := t.TempDir()
+	store, err := Open(t.TempDir(), "session", DefaultMaxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(work, "existing.txt")
+	created := filepath.Join(work, "created.txt")
+	writeFile(t, existing, "before")
+
+	store.Begin("edit files")
+	for _, path := range []string{existing, created, existing} {
+		if err := store.Snapshot(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(t, existing, "after")
+	writeFile(t, created, "new")
+	if err := store.Snapshot(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints := store.List()
+	if len(checkpoints) != 1 || len(checkpoints[0].Files) != 2 {
+		t.Fatalf("List() = %+v, want one checkpoint of two files", checkpoints)
+	}
+
+	undone, restored, err := store.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone.Prompt != "edit files" || len(restored) != 2 {
+		t.Errorf("Undo() = %+v, %q, want the turn and two files", undone, restored)
+	}
+	if got := readFile(t, existing); got != "before" {
+		t.Errorf("existing file = %q, want %q", got, "before")
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("created file still exists after undo")
+	}
+	if len(store.List()) != 0 {
+		t.Errorf("List() after undo = %+v, want none", store.List())
+	}
+	if _, _, err := store.Undo(); err == nil {
+		t.Errorf("Undo() without checkpoints succeeded")
+	}
+}
+
+func TestRestoreUndoesLaterTurns(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir, "session", DefaultMaxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file.txt")
+	writeFile(t, path, "v1")
+
+	for _, next := range []string{"v2", "v3", "v4"} {
+		store.Begin("write " + next)
+		if err := store.Snapshot(path); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, path, next)
+	}
+
+	// The index survives reopening the store
+	reopened, err := Open(dir, "session", DefaultMaxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkpoints := reopened.List()
+	if len(checkpoints) != 3 {
+		t.Fatalf("List() after reopening = %d checkpoints, want 3", len(checkpoints))
+	}
+
+	if _, err := reopened.Restore(checkpoints[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "v2" {
+		t.Errorf("file after restore = %q, want %q", got, "v2")
+	}
+	if got := reopened.List(); len(got) != 1 || got[0].ID != checkpoints[0].ID {
+		t.Errorf("List() after restore = %+v, want only the first checkpoint", got)
+	}
+	if _, err := reopened.Restore(42); err == nil {
+		t.Errorf("Restore() of an unknown checkpoint succeeded")
+	}
+}
+
+func TestSnapshotRejectsDirectories(t *testing.T) {
+	store, err := Open(t.TempDir(), "session", DefaultMaxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Snapshot(t.TempDir()); err == nil {
+		t.Errorf("Snapshot() of a directory succeeded")
+	}
+}
+
+func TestPruneRemovesOldSessions(t *testing.T) {
+	dir := t.TempDir()
+	old, err := Open(dir, "old", DefaultMaxAge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file.txt")
+	writeFile(t, path, "content")
+	old.Begin("old turn")
+	if err := old.Snapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * DefaultMaxAge)
+	if err := os.Chtimes(filepath.Join(dir, "old.json"), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dir, "new", DefaultMaxAge); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); !os.IsNotExist(err) {
+		t.Errorf("the index of the old session was kept")
+	}
+}
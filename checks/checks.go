@@ -0,0 +1,298 @@
+// Package checks verifies the files changed by the agent with gofmt, go vet,
+// go build or the language servers, so the model sees the problems it
+// introduced in the result of the edit and fixes them in the same turn
+package checks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KacemMathlouthi/go-code/lsp"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// DefaultChecks are run when GOCODE_CHECKS and --checks are not set
+const DefaultChecks = "gofmt,vet"
+
+// Names lists the available checks, in the order they run
+var Names = []string{"gofmt", "build", "vet", "lsp"}
+
+const (
+	// checkTimeout bounds each command, go vet and go build may have to
+	// compile dependencies first
+	checkTimeout = 2 * time.Minute
+	// maxReportLength caps the problems appended to a tool result
+	maxReportLength = 8000
+)
+
+// Parse validates a comma separated list of checks and returns them in run
+// order. "none" or "off" disables the checks.
+func Parse(spec string) ([]string, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+	if spec == "none" || spec == "off" || spec == "false" {
+		return nil, nil
+	}
+	requested := map[string]bool{}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, candidate := range Names {
+			known = known || candidate == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown check %q, expected some of %s or none", name, strings.Join(Names, ", "))
+		}
+		requested[name] = true
+	}
+
+	var enabled []string
+	for _, name := range Names {
+		if requested[name] {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled, nil
+}
+
+// module is a Go module containing changed packages
+type module struct {
+	root     string
+	packages []string
+}
+
+// Run runs the enabled checks that apply to paths and returns a report to
+// append to the tool result, empty when no check applies
+func Run(enabled []string, paths []string) string {
+	if len(enabled) == 0 || len(paths) == 0 {
+		return ""
+	}
+	start := time.Now()
+
+	var files, goFiles []string
+	seen := map[string]bool{}
+	for _, path := range paths {
+		absolute, err := filepath.Abs(path)
+		if err != nil || seen[absolute] {
+			continue
+		}
+		seen[absolute] = true
+		files = append(files, absolute)
+		if strings.HasSuffix(absolute, ".go") {
+			goFiles = append(goFiles, absolute)
+		}
+	}
+	sort.Strings(files)
+	modules := goModules(goFiles)
+
+	var ran, problems []string
+	// broken holds the modules go build already reported, go vet would only
+	// repeat the same compile errors
+	broken := map[string]bool{}
+	for _, name := range enabled {
+		switch name {
+		case "gofmt":
+			existing := existingFiles(goFiles)
+			if len(existing) == 0 {
+				continue
+			}
+			ran = append(ran, "gofmt")
+			problems = append(problems, runGofmt(existing)...)
+		case "build", "vet":
+			for _, m := range modules {
+				if broken[m.root] {
+					continue
+				}
+				ran = append(ran, "go "+name)
+				if report := runGo(m, name); report != "" {
+					problems = append(problems, report)
+					broken[m.root] = true
+				}
+			}
+		case "lsp":
+			for _, file := range existingFiles(files) {
+				if !lsp.Handles(file) {
+					continue
+				}
+				ran = append(ran, "lsp")
+				errors, err := lsp.FileErrors(file)
+				if err != nil {
+					problems = append(problems, "[lsp] "+err.Error())
+					continue
+				}
+				if len(errors) > 0 {
+					problems = append(problems, "[lsp diagnostics]\n"+strings.Join(errors, "\n"))
+				}
+			}
+		}
+	}
+	if len(ran) == 0 {
+		return ""
+	}
+	ran = unique(ran)
+
+	utils.LogInfo("Post-edit checks completed", "tool", map[string]interface{}{
+		"checks":      ran,
+		"files":       len(files),
+		"problems":    len(problems),
+		"duration":    time.Since(start).String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if len(problems) == 0 {
+		return fmt.Sprintf("\n\nPost-edit checks passed (%s).", strings.Join(ran, ", "))
+	}
+
+	report := truncateReport(strings.Join(problems, "\n"))
+	return fmt.Sprintf("\n\nPost-edit checks (%s) found problems, fix them before going on:\n%s", strings.Join(ran, ", "), report)
+}
+
+// truncateReport cuts a long report and says how much was left out
+func truncateReport(report string) string {
+	kept := utils.TruncateText(report, maxReportLength)
+	if len(kept) == len(report) {
+		return report
+	}
+	return kept + fmt.Sprintf("\n... (truncated, %d more bytes)", len(report)-len(kept))
+}
+
+// goModules groups the packages of the changed Go files by module. Packages
+// without Go files left, after a deletion, and files outside a module are
+// skipped.
+func goModules(goFiles []string) []*module {
+	byRoot := map[string]*module{}
+	var modules []*module
+	seen := map[string]bool{}
+	for _, file := range goFiles {
+		dir := filepath.Dir(file)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		if matches, _ := filepath.Glob(filepath.Join(dir, "*.go")); len(matches) == 0 {
+			continue
+		}
+		root := moduleRoot(dir)
+		if root == "" {
+			continue
+		}
+		m := byRoot[root]
+		if m == nil {
+			m = &module{root: root}
+			byRoot[root] = m
+			modules = append(modules, m)
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			continue
+		}
+		if rel == "." {
+			m.packages = append(m.packages, ".")
+		} else {
+			m.packages = append(m.packages, "./"+filepath.ToSlash(rel))
+		}
+	}
+	return modules
+}
+
+// moduleRoot returns the closest directory holding a go.mod above dir
+func moduleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func existingFiles(files []string) []string {
+	var existing []string
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			existing = append(existing, file)
+		}
+	}
+	return existing
+}
+
+// runGofmt lists the files that are not formatted and the syntax errors
+func runGofmt(files []string) []string {
+	stdout, stderr, err := run("", "gofmt", append([]string{"-l", "-e"}, files...)...)
+	var problems []string
+	if unformatted := strings.Fields(stdout); len(unformatted) > 0 {
+		for i, file := range unformatted {
+			unformatted[i] = lsp.DisplayPath(file)
+		}
+		problems = append(problems, "[gofmt] not formatted: "+strings.Join(unformatted, ", "))
+	}
+	if err != nil {
+		output := strings.TrimSpace(stderr)
+		if output == "" {
+			output = err.Error()
+		}
+		problems = append(problems, "[gofmt]\n"+output)
+	}
+	return problems
+}
+
+// runGo runs go build or go vet on the packages of a module and returns its
+// errors
+func runGo(m *module, command string) string {
+	args := []string{command}
+	if command == "build" {
+		// Type check and compile without leaving a binary behind
+		args = append(args, "-o", os.DevNull)
+	}
+	_, stderr, err := run(m.root, "go", append(args, m.packages...)...)
+	if err == nil {
+		return ""
+	}
+	header := "[go " + command + " " + strings.Join(m.packages, " ")
+	if cwd, _ := os.Getwd(); cwd != m.root {
+		header += " in " + lsp.DisplayPath(m.root)
+	}
+	output := strings.TrimSpace(stderr)
+	if output == "" {
+		output = err.Error()
+	}
+	return header + "]\n" + output
+}
+
+func run(dir, name string, args ...string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("%s timed out after %v", name, checkTimeout)
+	}
+	return stdout.String(), stderr.String(), err
+}
+
+func unique(items []string) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, item := range items {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+package checks
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: DefaultChecks, want: []string{"gofmt", "vet"}},
+		{spec: "vet, GOFMT", want: []string{"gofmt", "vet"}},
+		{spec: "lsp,build,vet,gofmt", want: []string{"gofmt", "build", "vet", "lsp"}},
+		{spec: "vet,,vet", want: []string{"vet"}},
+		{spec: "none", want: nil},
+		{spec: " off ", want: nil},
+		{spec: "", want: nil},
+		{spec: "gofmt,lint", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.spec)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error %v", test.spec, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%q) = %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestRunWithoutChecks(t *testing.T) {
+	if got := Run(nil, []string{"main.go"}); got != "" {
+		t.Errorf("Run() without checks = %q, want nothing", got)
+	}
+	if got := Run([]string{"gofmt"}, []string{"notes.txt"}); got != "" {
+		t.Errorf("Run() on a file no check applies to = %q, want nothing", got)
+	}
+}
@@ -0,0 +1,346 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/tools"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// autoCommitter turns each turn that changed files into a commit on a
+// dedicated branch. The commits are written straight to the branch, so HEAD,
+// the index and the working tree are left as they are.
+type autoCommitter struct {
+	branch string
+	// root is the top directory of the repository and prefix the working
+	// directory relative to it
+	root   string
+	prefix string
+	// touched are the files changed in the turn, relative to root
+	touched map[string]bool
+	// skip says why the turn is not committed. It is set at the first change
+	// of the turn when the working tree already differed from the branch, so
+	// the user's edits are never mixed in.
+	skip string
+	// out receives the commit notices, stdout by default
+	out io.Writer
+}
+
+// newAutoCommitter returns nil when auto-commit is off. The branch defaults to
+// go-code/<session id>.
+func newAutoCommitter() (*autoCommitter, error) {
+	envConfig := config.LoadEnvConfig()
+	if !autoCommit && !envConfig.AutoCommit {
+		return nil, nil
+	}
+	root, err := tools.RunGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("--auto-commit needs a git repository: %v", err)
+	}
+	prefix, err := tools.RunGit("rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, fmt.Errorf("--auto-commit needs a git repository: %v", err)
+	}
+
+	branch := autoCommitBranch
+	if branch == "" {
+		branch = envConfig.AutoCommitBranch
+	}
+	if branch == "" {
+		branch = "go-code/" + utils.SessionID()
+	}
+	if _, err := tools.RunGit("check-ref-format", "--branch", branch); err != nil {
+		return nil, fmt.Errorf("invalid auto-commit branch %q", branch)
+	}
+	return &autoCommitter{
+		branch:  branch,
+		root:    strings.TrimSpace(root),
+		prefix:  strings.TrimSpace(prefix),
+		touched: map[string]bool{},
+		out:     os.Stdout,
+	}, nil
+}
+
+// beginTurn forgets the files of the previous turn. Git is only run once a
+// file changes.
+func (a *autoCommitter) beginTurn() {
+	a.touched = map[string]bool{}
+	a.skip = ""
+}
+
+// track records a file a tool is about to change. Before the first change of
+// the turn it checks that the working tree matches the branch. Files left
+// unchanged are filtered out when committing.
+func (a *autoCommitter) track(path string) error {
+	file, ok := a.repoPath(path)
+	if !ok {
+		return nil
+	}
+	if len(a.touched) == 0 {
+		a.skip = a.pendingChanges()
+	}
+	a.touched[file] = true
+	return nil
+}
+
+// finishTurn commits the files touched in the turn with a generated message
+// and prints the commit hash
+func (a *autoCommitter) finishTurn(ctx context.Context, request string) {
+	if len(a.touched) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(a.touched))
+	for file := range a.touched {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+	if a.skip != "" {
+		utils.LogWarning("Auto-commit skipped", "git", map[string]interface{}{
+			"reason": a.skip,
+			"files":  paths,
+		})
+		fmt.Fprintln(a.out, utils.ColorYellow+"Auto-commit skipped this turn: "+a.skip+utils.ColorReset)
+		return
+	}
+
+	hash, message, err := a.commit(ctx, request, paths)
+	if err != nil {
+		utils.LogError("Auto-commit failed", "git", map[string]interface{}{
+			"error": err.Error(),
+		})
+		fmt.Fprintln(a.out, utils.FormatError("Auto-commit failed: "+err.Error()))
+		return
+	}
+	if hash == "" {
+		return
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	utils.LogInfo("Auto-committed turn", "git", map[string]interface{}{
+		"branch":  a.branch,
+		"commit":  hash,
+		"message": message,
+		"files":   len(paths),
+	})
+	fmt.Fprintln(a.out, utils.ColorGreen+fmt.Sprintf("📝 Committed %s on %s: %s", hash, a.branch, subject)+utils.ColorReset)
+}
+
+// commit stages paths in a temporary index on top of the branch, commits the
+// tree and moves the branch to it
+func (a *autoCommitter) commit(ctx context.Context, request string, paths []string) (string, string, error) {
+	base := a.base()
+	dir, err := os.MkdirTemp("", "go-code-commit")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+	env, err := a.baseIndex(dir, base)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Keep the files that still differ from the branch, leaving out those
+	// written back as they were, created then deleted, or ignored
+	var changed []string
+	for _, file := range paths {
+		if a.unchanged(env, base, file) {
+			continue
+		}
+		if _, err := a.git(env, "check-ignore", "--quiet", "--", file); err == nil {
+			continue
+		}
+		changed = append(changed, file)
+	}
+	if len(changed) == 0 {
+		return "", "", nil
+	}
+
+	// -A stages deletions too
+	if _, err := a.git(env, append([]string{"add", "-A", "--"}, changed...)...); err != nil {
+		return "", "", err
+	}
+	diffArgs := []string{"diff", "--cached", "--no-ext-diff", "--stat", "--patch"}
+	if base != "" {
+		diffArgs = append(diffArgs, base)
+	}
+	diff, err := a.git(env, diffArgs...)
+	if err != nil {
+		return "", "", err
+	}
+	tree, err := a.git(env, "write-tree")
+	if err != nil {
+		return "", "", err
+	}
+
+	message, err := agent.GenerateCommitMessage(ctx, request, diff)
+	if err != nil {
+		utils.LogWarning("Commit message generation failed", "git", map[string]interface{}{
+			"error": err.Error(),
+		})
+		message = fallbackCommitMessage(changed)
+	}
+	commitArgs := []string{"commit-tree", strings.TrimSpace(tree), "-m", message}
+	if base != "" {
+		commitArgs = append(commitArgs, "-p", base)
+	}
+	hash, err := a.git(nil, commitArgs...)
+	if err != nil {
+		return "", "", err
+	}
+	hash = strings.TrimSpace(hash)
+
+	// The expected old value makes the update fail if the branch moved
+	// meanwhile, an empty one that it must not exist yet
+	tip, _ := a.git(nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+a.branch)
+	created := strings.TrimSpace(tip) == ""
+	if _, err := a.git(nil, "update-ref", "-m", "go-code: auto-commit", "refs/heads/"+a.branch, hash, strings.TrimSpace(tip)); err != nil {
+		return "", "", err
+	}
+	if created {
+		utils.LogInfo("Created auto-commit branch", "git", map[string]interface{}{
+			"branch": a.branch,
+			"from":   base,
+		})
+		fmt.Fprintln(a.out, utils.ColorDim+"Auto-commit: created branch "+a.branch+", the working tree stays on the current branch"+utils.ColorReset)
+	}
+
+	// With the branch checked out, e.g. in a worktree, the index has to follow
+	// the new commit or the changes would show as reverted
+	if current, _ := a.git(nil, "symbolic-ref", "--quiet", "HEAD"); strings.TrimSpace(current) == "refs/heads/"+a.branch {
+		if _, err := a.git(nil, append([]string{"reset", "--quiet", "--"}, changed...)...); err != nil {
+			return "", "", err
+		}
+	}
+
+	short, err := a.git(nil, "rev-parse", "--short", hash)
+	return strings.TrimSpace(short), message, err
+}
+
+// pendingChanges describes the files of the working tree that differ from the
+// branch, modified or untracked, and is empty when there are none
+func (a *autoCommitter) pendingChanges() string {
+	dir, err := os.MkdirTemp("", "go-code-status")
+	if err != nil {
+		return "could not check the working tree: " + err.Error()
+	}
+	defer os.RemoveAll(dir)
+	env, err := a.baseIndex(dir, a.base())
+	if err == nil {
+		// The temporary index has no file times, refresh them so files are
+		// compared by content
+		a.git(env, "update-index", "-q", "--refresh")
+	}
+	var modified, untracked string
+	if err == nil {
+		modified, err = a.git(env, "diff", "--name-only", "--no-renames")
+	}
+	if err == nil {
+		untracked, err = a.git(env, "ls-files", "--others", "--exclude-standard")
+	}
+	if err != nil {
+		return "could not check the working tree: " + err.Error()
+	}
+
+	var files []string
+	for _, line := range strings.Split(modified+untracked, "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	sort.Strings(files)
+	if len(files) > 5 {
+		files = append(files[:5], fmt.Sprintf("%d more", len(files)-5))
+	}
+	return "the working tree already had uncommitted changes (" + strings.Join(files, ", ") + "), commit or stash them to resume auto-commits"
+}
+
+// baseIndex fills a temporary index in dir with the tree of base, or an empty
+// one without base, and returns the environment that makes git use it
+func (a *autoCommitter) baseIndex(dir, base string) ([]string, error) {
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+	readTree := []string{"read-tree", "--empty"}
+	if base != "" {
+		readTree = []string{"read-tree", base}
+	}
+	if _, err := a.git(env, readTree...); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// base returns the commit the next auto-commit goes on: the tip of the
+// branch, or HEAD until the branch exists. It is empty in a repository
+// without commits.
+func (a *autoCommitter) base() string {
+	for _, revision := range []string{"refs/heads/" + a.branch, "HEAD"} {
+		if hash, err := a.git(nil, "rev-parse", "--verify", "--quiet", revision+"^{commit}"); err == nil {
+			return strings.TrimSpace(hash)
+		}
+	}
+	return ""
+}
+
+// unchanged reports whether file in the working tree matches its version in
+// base, both missing counting as a match
+func (a *autoCommitter) unchanged(env []string, base, file string) bool {
+	committed := ""
+	if base != "" {
+		if blob, err := a.git(env, "rev-parse", "--verify", "--quiet", base+":"+file); err == nil {
+			committed = strings.TrimSpace(blob)
+		}
+	}
+	current := ""
+	if _, err := os.Lstat(filepath.Join(a.root, file)); err == nil {
+		blob, err := a.git(env, "hash-object", "--", file)
+		if err != nil {
+			return false
+		}
+		current = strings.TrimSpace(blob)
+	}
+	return committed == current
+}
+
+// repoPath returns path relative to the top of the repository, false when it
+// is outside
+func (a *autoCommitter) repoPath(path string) (string, bool) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(cwd, absolute)
+	if err != nil {
+		return "", false
+	}
+	file := filepath.ToSlash(filepath.Join(a.prefix, rel))
+	if file == "." || file == ".." || strings.HasPrefix(file, "../") {
+		return "", false
+	}
+	return file, true
+}
+
+// git runs git at the top of the repository
+func (a *autoCommitter) git(env []string, args ...string) (string, error) {
+	return tools.RunGitEnv(a.root, env, args...)
+}
+
+// fallbackCommitMessage is used when the model can't be reached
+func fallbackCommitMessage(paths []string) string {
+	if len(paths) == 1 {
+		return "chore: update " + paths[0]
+	}
+	return fmt.Sprintf("chore: update %d files\n\n%s", len(paths), strings.Join(paths, "\n"))
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/KacemMathlouthi/go-code/tools"
+)
+
+func TestAutoCommitSkipsDirtyTree(t *testing.T) {
+	repo := initRepository(t)
+	if err := os.WriteFile("main.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{"add", "main.go"}, {"commit", "-q", "-m", "add main"}} {
+		if _, err := tools.RunGit(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := &autoCommitter{branch: "go-code/test", root: repo, touched: map[string]bool{}, out: io.Discard}
+
+	if pending := a.pendingChanges(); pending != "" {
+		t.Errorf("pendingChanges() of a clean tree = %q, want none", pending)
+	}
+	if err := os.WriteFile("main.go", []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("notes.txt", []byte("todo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pending := a.pendingChanges(); !strings.Contains(pending, "(main.go, notes.txt)") {
+		t.Errorf("pendingChanges() = %q, want the modified and untracked files", pending)
+	}
+
+	// The turn touches another file, the whole commit is skipped
+	a.beginTurn()
+	a.track("other.go")
+	if err := os.WriteFile("other.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.finishTurn(context.Background(), "add other.go")
+	if _, err := tools.RunGit("rev-parse", "--verify", "--quiet", "refs/heads/go-code/test"); err == nil {
+		t.Errorf("finishTurn() committed a turn started with uncommitted changes")
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/checkpoint"
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/utils"
+	"github.com/openai/openai-go"
+)
+
+// openCheckpoints opens the checkpoint store of this run, or returns nil when
+// the state directory can't be used
+func openCheckpoints() *checkpoint.Store {
+	dir, err := config.CheckpointDir()
+	if err == nil {
+		var store *checkpoint.Store
+		store, err = checkpoint.Open(dir, utils.SessionID(), checkpoint.DefaultMaxAge)
+		if store != nil {
+			if err != nil {
+				utils.LogWarning("Checkpoint cleanup failed", "system", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			return store
+		}
+	}
+	utils.LogWarning("Checkpoints disabled", "system", map[string]interface{}{
+		"error": err.Error(),
+	})
+	return nil
+}
+
+// checkpointCommands are the /undo, /checkpoints and /restore commands
+func checkpointCommands() []*replCommand {
+	return []*replCommand{
+		{
+			Name:        "undo",
+			Description: "Revert the file changes of the last turn that changed files",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				if s.checkpoints == nil {
+					return fmt.Errorf("checkpoints are not available")
+				}
+				undone, restored, err := s.checkpoints.Undo()
+				printRestored(restored)
+				if err != nil {
+					return err
+				}
+				s.noteRestore(fmt.Sprintf("checkpoint %d (%q)", undone.ID, undone.Prompt), restored)
+				fmt.Println(utils.ColorGreen + fmt.Sprintf("Reverted checkpoint %d.", undone.ID) + utils.ColorReset)
+				return nil
+			},
+		},
+		{
+			Name:        "checkpoints",
+			Description: "List the file checkpoints of this session",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				if s.checkpoints == nil {
+					return fmt.Errorf("checkpoints are not available")
+				}
+				printCheckpoints(s.checkpoints.List())
+				return nil
+			},
+		},
+		{
+			Name:        "restore",
+			Args:        "<id>",
+			Description: "Put the files back as they were before a checkpoint, undoing it and all later ones",
+			MaxArgs:     1,
+			Run: func(s *session, args []string) error {
+				if s.checkpoints == nil {
+					return fmt.Errorf("checkpoints are not available")
+				}
+				if len(args) == 0 {
+					return fmt.Errorf("usage: /restore <id>, type /checkpoints to list them")
+				}
+				id, err := strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+				if err != nil {
+					return fmt.Errorf("invalid checkpoint %q", args[0])
+				}
+				restored, err := s.checkpoints.Restore(id)
+				printRestored(restored)
+				if err != nil {
+					return err
+				}
+				s.noteRestore(fmt.Sprintf("checkpoint %d and the later ones", id), restored)
+				fmt.Println(utils.ColorGreen + fmt.Sprintf("Restored the files as they were before checkpoint %d.", id) + utils.ColorReset)
+				return nil
+			},
+		},
+	}
+}
+
+// noteRestore tells the model that files changed behind its back, so it
+// doesn't rely on the content it wrote before
+func (s *session) noteRestore(what string, restored []string) {
+	if len(restored) == 0 {
+		return
+	}
+	note := fmt.Sprintf("[I reverted the file changes of %s:\n%s]", what, strings.Join(restored, "\n"))
+	s.history = append(s.history, openai.UserMessage(note))
+	s.messages = append(s.messages, savedMessage{Role: "user", Content: note})
+	utils.LogInfo("Checkpoint restored", "interaction", map[string]interface{}{
+		"checkpoint": what,
+		"files":      restored,
+	})
+}
+
+func printRestored(restored []string) {
+	for _, line := range restored {
+		fmt.Println(utils.ColorDim + "  " + line + utils.ColorReset)
+	}
+}
+
+func printCheckpoints(checkpoints []checkpoint.Checkpoint) {
+	if len(checkpoints) == 0 {
+		fmt.Println(utils.ColorYellow + "No checkpoints yet, they are created when the agent writes or deletes files." + utils.ColorReset)
+		return
+	}
+	fmt.Println(utils.ColorYellow + utils.ColorBold + "Checkpoints:" + utils.ColorReset)
+	for _, c := range checkpoints {
+		prompt := c.Prompt
+		if line, _, found := strings.Cut(prompt, "\n"); found {
+			prompt = line + " ..."
+		}
+		fmt.Printf("  %s#%-3d%s %s  %d file(s)  %s\n", utils.ColorCyan, c.ID, utils.ColorReset,
+			c.Created.Format("15:04:05"), len(c.Files), utils.ColorDim+prompt+utils.ColorReset)
+		for _, file := range c.Files {
+			action := "changed"
+			if !file.Existed {
+				action = "created"
+			}
+			fmt.Printf("        %s %s\n", action, file.Path)
+		}
+	}
+}
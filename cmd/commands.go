@@ -0,0 +1,379 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// replCommand is a slash command available in the REPL
+type replCommand struct {
+	Name        string
+	Aliases     []string
+	Args        string
+	Description string
+	// MaxArgs is the number of arguments accepted, -1 for any
+	MaxArgs int
+	Run     func(s *session, args []string) error
+}
+
+// commandRegistry resolves slash commands by name or alias
+type commandRegistry struct {
+	commands []*replCommand
+	byName   map[string]*replCommand
+}
+
+func newCommandRegistry() *commandRegistry {
+	r := &commandRegistry{byName: map[string]*replCommand{}}
+	for _, command := range append(builtinCommands(), checkpointCommands()...) {
+		r.register(command)
+	}
+	for _, command := range loadCustomCommands() {
+		if _, exists := r.byName[command.Name]; exists {
+			utils.LogWarning("Custom command shadows an existing command", "system", map[string]interface{}{
+				"command": command.Name,
+			})
+			continue
+		}
+		r.register(command)
+	}
+	return r
+}
+
+func (r *commandRegistry) register(command *replCommand) {
+	r.commands = append(r.commands, command)
+	r.byName[command.Name] = command
+	for _, alias := range command.Aliases {
+		r.byName[alias] = command
+	}
+}
+
+// names returns every command name and alias with its leading slash
+func (r *commandRegistry) names() []string {
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, "/"+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// execute parses and runs a slash command line
+func (r *commandRegistry) execute(s *session, input string) error {
+	args, err := splitArgs(strings.TrimPrefix(input, "/"))
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing command name, type /help to list commands")
+	}
+
+	command, ok := r.byName[strings.ToLower(args[0])]
+	if !ok {
+		return fmt.Errorf("unknown command /%s, type /help to list commands", args[0])
+	}
+	args = args[1:]
+	if command.MaxArgs >= 0 && len(args) > command.MaxArgs {
+		return fmt.Errorf("usage: %s", command.usage())
+	}
+
+	utils.LogInfo("REPL command", "interaction", map[string]interface{}{
+		"command": command.Name,
+		"args":    len(args),
+	})
+	return command.Run(s, args)
+}
+
+func (c *replCommand) usage() string {
+	if c.Args == "" {
+		return "/" + c.Name
+	}
+	return "/" + c.Name + " " + c.Args
+}
+
+// splitArgs splits a command line on spaces, honoring single and double quotes
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in command")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// printHelp lists the registered commands
+func (r *commandRegistry) printHelp() {
+	fmt.Println(utils.ColorYellow + utils.ColorBold + "Available commands:" + utils.ColorReset)
+	fmt.Println("  Type any text to get a response from the AI agent")
+
+	width := 0
+	for _, command := range r.commands {
+		width = max(width, len(command.usage()))
+	}
+	for _, command := range r.commands {
+		description := command.Description
+		if len(command.Aliases) > 0 {
+			description += " (alias: /" + strings.Join(command.Aliases, ", /") + ")"
+		}
+		fmt.Printf("  %s%-*s%s  %s\n", utils.ColorCyan, width, command.usage(), utils.ColorReset, description)
+	}
+	fmt.Println()
+}
+
+func builtinCommands() []*replCommand {
+	return []*replCommand{
+		{
+			Name:        "help",
+			Description: "Show this help message",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				s.commands.printHelp()
+				return nil
+			},
+		},
+		{
+			Name:        "clear",
+			Description: "Clear the conversation history and the screen",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				s.clear()
+				utils.ClearScreen()
+				return nil
+			},
+		},
+		{
+			Name:        "config",
+			Description: "Show the current llm model and tools",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				utils.GetConfigText(agent.CurrentModel())
+				return nil
+			},
+		},
+		{
+			Name:        "model",
+			Args:        "[name|default]",
+			Description: "Show or switch the model used for this session",
+			MaxArgs:     1,
+			Run: func(s *session, args []string) error {
+				if len(args) == 1 {
+					if args[0] == "default" {
+						agent.SetModel("")
+					} else {
+						agent.SetModel(args[0])
+					}
+				}
+				fmt.Println(utils.ColorGreen + "Model: " + agent.CurrentModel() + utils.ColorReset)
+				return nil
+			},
+		},
+		{
+			Name:        "iterations",
+			Args:        "[n]",
+			Description: "Show or change the tool loop step limit for this session",
+			MaxArgs:     1,
+			Run: func(s *session, args []string) error {
+				if len(args) == 0 {
+					fmt.Printf("Iteration limit: %d\n", s.loop.MaxIterations)
+					return nil
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n <= 0 {
+					return fmt.Errorf("usage: /iterations <positive number>")
+				}
+				s.loop.MaxIterations = n
+				fmt.Println(utils.ColorGreen + fmt.Sprintf("Iteration limit set to %d for this session.", n) + utils.ColorReset)
+				return nil
+			},
+		},
+		{
+			Name:        "expand",
+			Args:        "[n]",
+			Description: "Show the full output of a tool call from the last answer",
+			MaxArgs:     1,
+			Run: func(s *session, args []string) error {
+				return expandToolOutput(s.activity, args)
+			},
+		},
+		{
+			Name:        "instructions",
+			Description: "Show the GOCODE.md instructions loaded into the prompt",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				return showInstructions()
+			},
+		},
+		{
+			Name:        "save",
+			Args:        "[name]",
+			Description: "Save the conversation",
+			MaxArgs:     1,
+			Run: func(s *session, args []string) error {
+				name := ""
+				if len(args) == 1 {
+					name = args[0]
+				}
+				path, err := s.save(name)
+				if err != nil {
+					return err
+				}
+				fmt.Println(utils.ColorGreen + "Conversation saved to " + path + utils.ColorReset)
+				return nil
+			},
+		},
+		{
+			Name:        "resume",
+			Args:        "[name]",
+			Description: "Resume a saved conversation, or list them",
+			MaxArgs:     1,
+			Run: func(s *session, args []string) error {
+				if len(args) == 0 {
+					names, err := savedSessionNames()
+					if err != nil || len(names) == 0 {
+						fmt.Println(utils.ColorYellow + "No saved conversations." + utils.ColorReset)
+						return nil
+					}
+					fmt.Println(utils.ColorYellow + utils.ColorBold + "Saved conversations:" + utils.ColorReset)
+					for _, name := range names {
+						fmt.Println("  " + name)
+					}
+					return nil
+				}
+				count, err := s.resume(args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Println(utils.ColorGreen + fmt.Sprintf("Resumed %q (%d messages).", args[0], count) + utils.ColorReset)
+				return nil
+			},
+		},
+		{
+			Name:        "usage",
+			Description: "Show token usage for this session",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				fmt.Println(utils.ColorYellow + utils.ColorBold + "Token usage:" + utils.ColorReset)
+				fmt.Printf("  Requests: %d\n", s.usage.Requests)
+				fmt.Printf("  Prompt tokens: %d\n", s.usage.PromptTokens)
+				fmt.Printf("  Completion tokens: %d\n", s.usage.CompletionTokens)
+				fmt.Printf("  Total tokens: %d\n", s.usage.PromptTokens+s.usage.CompletionTokens)
+				for model, tokens := range s.usage.ByModel {
+					fmt.Printf("    %s: %d\n", model, tokens)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        "quit",
+			Aliases:     []string{"exit"},
+			Description: "Exit go-code",
+			MaxArgs:     0,
+			Run: func(s *session, args []string) error {
+				return errQuit
+			},
+		},
+	}
+}
+
+// complete completes slash commands at the start of the input, @mentions and
+// file paths everywhere else
+func (s *session) complete(line string, cursor int) (int, []string) {
+	runes := []rune(line)
+	start := cursor
+	for start > 0 && runes[start-1] != ' ' && runes[start-1] != '\n' {
+		start--
+	}
+	word := string(runes[start:cursor])
+
+	if start == 0 && strings.HasPrefix(word, "/") {
+		return start, utils.CompleteWord(word, s.commands.names())
+	}
+	if mention, ok := strings.CutPrefix(word, "@"); ok {
+		candidates := utils.CompletePath(mention)
+		for i, candidate := range candidates {
+			candidates[i] = "@" + candidate
+		}
+		return start, candidates
+	}
+	return start, utils.CompletePath(word)
+}
+
+// expandToolOutput prints the full output of a tool call from the last turn,
+// the most recent one when no index is given
+func expandToolOutput(activity *utils.ToolActivity, args []string) error {
+	outputs := activity.Outputs()
+	if len(outputs) == 0 {
+		fmt.Println(utils.ColorYellow + "No tool output in the last turn." + utils.ColorReset)
+		return nil
+	}
+
+	index := len(outputs)
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(outputs) {
+			return fmt.Errorf("usage: /expand <1-%d>", len(outputs))
+		}
+		index = n
+	}
+
+	output := outputs[index-1]
+	fmt.Println(utils.ColorCyan + utils.ColorBold + output.Description + utils.ColorReset)
+	fmt.Println(output.Output)
+	return nil
+}
+
+// showInstructions prints the instruction files loaded into the system prompt
+func showInstructions() error {
+	files, err := agent.LoadInstructionFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		fmt.Println(utils.ColorYellow + "No " + agent.InstructionFileName + " instruction files found." + utils.ColorReset)
+		return nil
+	}
+
+	fmt.Println(utils.ColorYellow + utils.ColorBold + "Loaded instructions:" + utils.ColorReset)
+	for _, file := range files {
+		note := ""
+		if file.Truncated {
+			note = " (truncated)"
+		}
+		fmt.Println(utils.ColorCyan + utils.ColorBold + file.Path + note + utils.ColorReset)
+		fmt.Println(file.Content)
+		fmt.Println()
+	}
+	return nil
+}
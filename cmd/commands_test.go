@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{line: "", want: nil},
+		{line: "one two\tthree", want: []string{"one", "two", "three"}},
+		{line: "  spaced   out  ", want: []string{"spaced", "out"}},
+		{line: `say "hello world" 'it''s'`, want: []string{"say", "hello world", "its"}},
+		{line: `empty "" arg`, want: []string{"empty", "", "arg"}},
+		{line: `mixed"quo ted"word`, want: []string{"mixedquo tedword"}},
+		{line: `"unterminated`, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.line)
+		if (err != nil) != test.wantErr {
+			t.Errorf("splitArgs(%q) error = %v, want error %v", test.line, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestExpandCommandPrompt(t *testing.T) {
+	tests := []struct {
+		prompt string
+		args   []string
+		want   string
+	}{
+		{"Review the code", nil, "Review the code"},
+		{"Review the code", []string{"cmd", "utils"}, "Review the code\n\ncmd utils"},
+		{"Review $ARGUMENTS", []string{"cmd", "utils"}, "Review cmd utils"},
+		{"Compare $1 with $2", []string{"a.go", "b.go"}, "Compare a.go with b.go"},
+		{"Only $1 and $2", []string{"one"}, "Only one and "},
+		{"Check prices in $USD", []string{"cart.go"}, "Check prices in $USD\n\ncart.go"},
+	}
+	for _, test := range tests {
+		if got := expandCommandPrompt(test.prompt, test.args); got != test.want {
+			t.Errorf("expandCommandPrompt(%q, %q) = %q, want %q", test.prompt, test.args, got, test.want)
+		}
+	}
+}
+
+func TestLoadCustomCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Review.md")
+	content := "---\r\ndescription: Review the staged changes\r\nargs: [focus]\r\n---\r\nReview my staged changes, focusing on $ARGUMENTS.\r\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	command, err := loadCustomCommand(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Name != "review" || command.Description != "Review the staged changes" || command.Args != "[focus]" {
+		t.Errorf("loadCustomCommand() = %q, %q, %q, want the name and front matter", command.Name, command.Description, command.Args)
+	}
+}
+
+func TestSessionFile(t *testing.T) {
+	dir := t.TempDir()
+	if path, err := sessionFile(dir, "refactor-1"); err != nil || path != filepath.Join(dir, "refactor-1.json") {
+		t.Errorf("sessionFile(refactor-1) = %q, %v, want a file in the sessions directory", path, err)
+	}
+	for _, name := range []string{"..", "../escape", "a/b", `a\b`, "/tmp/x"} {
+		if path, err := sessionFile(dir, name); err == nil {
+			t.Errorf("sessionFile(%q) = %q, want an error", name, path)
+		}
+	}
+}
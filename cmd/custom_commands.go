@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// customCommandsDir is where a project keeps its markdown prompt commands
+const customCommandsDir = ".gocode/commands"
+
+// loadCustomCommands turns markdown prompt files into slash commands. Files
+// come from <config dir>/commands and <project root>/.gocode/commands; a
+// project command replaces a user command with the same name.
+func loadCustomCommands() []*replCommand {
+	var dirs []string
+	if dir, err := config.ConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "commands"))
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, filepath.Join(agent.FindProjectRoot(cwd), customCommandsDir))
+	}
+
+	byName := map[string]*replCommand{}
+	var order []string
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.md"))
+		for _, path := range paths {
+			command, err := loadCustomCommand(path)
+			if err != nil {
+				utils.LogWarning("Failed to load custom command", "system", map[string]interface{}{
+					"path":  path,
+					"error": err.Error(),
+				})
+				continue
+			}
+			if _, exists := byName[command.Name]; !exists {
+				order = append(order, command.Name)
+			}
+			byName[command.Name] = command
+		}
+	}
+
+	commands := make([]*replCommand, 0, len(order))
+	for _, name := range order {
+		commands = append(commands, byName[name])
+	}
+	return commands
+}
+
+// loadCustomCommand reads a prompt file. An optional front matter block sets
+// the description and argument hint:
+//
+//	---
+//	description: Review the staged changes
+//	args: [focus]
+//	---
+//	Review my staged changes, focusing on $ARGUMENTS.
+func loadCustomCommand(path string) (*replCommand, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".md"))
+	description := "Custom prompt from " + path
+	argsHint := ""
+	body := strings.ReplaceAll(string(content), "\r\n", "\n")
+
+	if rest, ok := strings.CutPrefix(body, "---\n"); ok {
+		if header, prompt, found := strings.Cut(rest, "\n---\n"); found {
+			body = prompt
+			for _, line := range strings.Split(header, "\n") {
+				key, value, _ := strings.Cut(line, ":")
+				switch strings.TrimSpace(key) {
+				case "description":
+					description = strings.TrimSpace(value)
+				case "args":
+					argsHint = strings.TrimSpace(value)
+				}
+			}
+		}
+	}
+	prompt := strings.TrimSpace(body)
+
+	return &replCommand{
+		Name:        name,
+		Args:        argsHint,
+		Description: description,
+		MaxArgs:     -1,
+		Run: func(s *session, args []string) error {
+			s.send(expandCommandPrompt(prompt, args))
+			return nil
+		},
+	}, nil
+}
+
+// expandCommandPrompt substitutes $ARGUMENTS and $1..$9 in a prompt. Arguments
+// are appended when the prompt has no placeholder for them.
+func expandCommandPrompt(prompt string, args []string) string {
+	if len(args) > 0 && !hasPlaceholders(prompt) {
+		return prompt + "\n\n" + strings.Join(args, " ")
+	}
+
+	for i := 9; i >= 1; i-- {
+		value := ""
+		if i <= len(args) {
+			value = args[i-1]
+		}
+		prompt = strings.ReplaceAll(prompt, "$"+string(rune('0'+i)), value)
+	}
+	return strings.ReplaceAll(prompt, "$ARGUMENTS", strings.Join(args, " "))
+}
+
+// hasPlaceholders reports whether prompt uses $ARGUMENTS or $1 to $9
+func hasPlaceholders(prompt string) bool {
+	if strings.Contains(prompt, "$ARGUMENTS") {
+		return true
+	}
+	for i := 1; i <= 9; i++ {
+		if strings.Contains(prompt, "$"+string(rune('0'+i))) {
+			return true
+		}
+	}
+	return false
+}
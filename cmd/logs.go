@@ -0,0 +1,442 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/utils"
+	"github.com/spf13/cobra"
+)
+
+// logsCmd reads back the session logs
+var logsCmd = &cobra.Command{
+	Use:   "logs [session]",
+	Short: "List sessions and replay their logs",
+	Long: `List the logged sessions, or show the entries of a session as a turn by turn
+timeline. The session is an ID, a unique ID prefix or "last".
+
+Without a session, filters apply to the entries of every session.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLogs,
+}
+
+var (
+	logsLevel    string
+	logsCategory string
+	logsSince    string
+	logsUntil    string
+	logsMarkdown bool
+	logsOutput   string
+)
+
+// maxMarkdownResultLines bounds the tool output kept in a Markdown export
+const maxMarkdownResultLines = 20
+
+// logTurn is a user request and the entries logged while answering it
+type logTurn struct {
+	start   utils.LogEntry
+	entries []utils.LogEntry
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	dir, err := config.LogDir()
+	if err != nil {
+		return err
+	}
+	sessions, err := utils.ListLogSessions(dir)
+	if err != nil {
+		return err
+	}
+
+	filter, err := logFilter()
+	if err != nil {
+		return err
+	}
+	filtered := filter != utils.LogFilter{}
+
+	out := io.Writer(os.Stdout)
+	if logsOutput != "" {
+		file, err := os.OpenFile(logsOutput, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+		// No escape sequences in files
+		if err := utils.ConfigureColors(utils.ColorNever, ""); err != nil {
+			return err
+		}
+	}
+
+	if len(args) == 0 {
+		if logsMarkdown {
+			return fmt.Errorf("--markdown needs a session, e.g. go-code logs last --markdown")
+		}
+		if !filtered {
+			printLogSessions(out, dir, sessions)
+			return nil
+		}
+		for i := len(sessions) - 1; i >= 0; i-- {
+			entries, err := utils.ReadLogEntries(sessions[i], filter)
+			if err != nil {
+				return err
+			}
+			if len(entries) > 0 {
+				printTimeline(out, sessions[i], entries)
+			}
+		}
+		return nil
+	}
+
+	session, err := utils.FindLogSession(sessions, args[0])
+	if err != nil {
+		return err
+	}
+	entries, err := utils.ReadLogEntries(session, filter)
+	if err != nil {
+		return err
+	}
+	if logsMarkdown {
+		fmt.Fprint(out, sessionMarkdown(session, entries))
+	} else {
+		printTimeline(out, session, entries)
+	}
+	if logsOutput != "" {
+		fmt.Println(utils.ColorGreen + "Wrote " + logsOutput + utils.ColorReset)
+	}
+	return nil
+}
+
+// logFilter builds the filter from the flags
+func logFilter() (utils.LogFilter, error) {
+	var filter utils.LogFilter
+	if logsLevel != "" {
+		level, err := utils.ParseLogLevel(logsLevel)
+		if err != nil {
+			return filter, err
+		}
+		filter.MinLevel = level
+	}
+	filter.Category = logsCategory
+
+	var err error
+	if filter.Since, err = parseLogTime(logsSince); err != nil {
+		return filter, err
+	}
+	if filter.Until, err = parseLogTime(logsUntil); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// parseLogTime accepts a duration before now such as "2h", a date, or a date
+// and time in local time or RFC 3339
+func parseLogTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use a duration like 2h, a date like 2006-01-02 or RFC 3339", value)
+}
+
+func printLogSessions(out io.Writer, dir string, sessions []utils.LogSession) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(out, utils.ColorYellow+"No session logs in "+dir+utils.ColorReset)
+		return
+	}
+	fmt.Fprintln(out, utils.ColorYellow+utils.ColorBold+"Sessions in "+dir+":"+utils.ColorReset)
+	for _, session := range sessions {
+		fmt.Fprintf(out, "  %s%s%s  last written %s  %s, %d file(s)\n", utils.ColorCyan, session.ID, utils.ColorReset,
+			session.ModTime.Format("2006-01-02 15:04"), formatSize(session.Size), len(session.Files))
+	}
+}
+
+// splitTurns groups entries into turns, each starting with a user request.
+// Entries logged before the first request are returned separately.
+func splitTurns(entries []utils.LogEntry) ([]utils.LogEntry, []logTurn) {
+	var setup []utils.LogEntry
+	var turns []logTurn
+	for _, entry := range entries {
+		switch {
+		case entry.Message == "User input received" || entry.Message == "One-shot prompt received":
+			turns = append(turns, logTurn{start: entry})
+		case len(turns) == 0:
+			setup = append(setup, entry)
+		default:
+			turn := &turns[len(turns)-1]
+			turn.entries = append(turn.entries, entry)
+		}
+	}
+	return setup, turns
+}
+
+// duration returns how long the turn took, from its completion entry or its
+// last entry
+func (t logTurn) duration() time.Duration {
+	for _, entry := range t.entries {
+		if entry.Message == "Turn completed" {
+			if ms, ok := entry.Data["duration_ms"].(float64); ok {
+				return time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	if len(t.entries) == 0 {
+		return 0
+	}
+	return t.entries[len(t.entries)-1].Time().Sub(t.start.Time())
+}
+
+// response returns the last LLM response of the turn
+func (t logTurn) response() (utils.LogEntry, bool) {
+	for i := len(t.entries) - 1; i >= 0; i-- {
+		if t.entries[i].Message == "LLM Response" {
+			return t.entries[i], true
+		}
+	}
+	return utils.LogEntry{}, false
+}
+
+func printTimeline(out io.Writer, session utils.LogSession, entries []utils.LogEntry) {
+	fmt.Fprintf(out, "%sSession %s%s  %d entries\n", utils.ColorYellow+utils.ColorBold, session.ID, utils.ColorReset, len(entries))
+
+	setup, turns := splitTurns(entries)
+	for _, entry := range setup {
+		if line := describeLogEntry(entry, nil); line != "" {
+			fmt.Fprintf(out, "  %s%s%s  %s\n", utils.ColorDim, entry.Time().Local().Format("15:04:05.000"), utils.ColorReset, line)
+		}
+	}
+
+	for i, turn := range turns {
+		start := turn.start.Time()
+		fmt.Fprintf(out, "\n%sTurn %d%s  %s  %s(%s)%s\n", utils.ColorCyan+utils.ColorBold, i+1, utils.ColorReset,
+			start.Local().Format("2006-01-02 15:04:05"), utils.ColorDim, formatLogDuration(turn.duration()), utils.ColorReset)
+		fmt.Fprintf(out, "  %s> %s%s\n", utils.ColorBold, firstLine(logField(turn.start, "input")), utils.ColorReset)
+
+		toolArgs := map[string]interface{}{}
+		for _, entry := range turn.entries {
+			if entry.Message == "Tool Call" {
+				toolArgs[logField(entry, "tool_name")] = entry.Data["tool_args"]
+				continue
+			}
+			line := describeLogEntry(entry, toolArgs)
+			if line == "" {
+				continue
+			}
+			offset := entry.Time().Sub(start)
+			fmt.Fprintf(out, "  %s+%-7s%s %s\n", utils.ColorDim, formatLogDuration(offset), utils.ColorReset, line)
+		}
+	}
+	fmt.Fprintln(out)
+}
+
+// describeLogEntry summarizes an entry on one line, or returns an empty
+// string for entries that only add noise to a timeline
+func describeLogEntry(entry utils.LogEntry, toolArgs map[string]interface{}) string {
+	switch entry.Message {
+	case "LLM Response":
+		return fmt.Sprintf("%sLLM%s %s %s(%s)%s", utils.ColorMagenta, utils.ColorReset, logField(entry, "model"),
+			utils.ColorDim, formatLogDuration(logDuration(entry)), utils.ColorReset)
+	case "Tool Execution Success", "Tool Execution Failed":
+		name := logField(entry, "tool_name")
+		mark := utils.ColorGreen + "✓" + utils.ColorReset
+		if entry.Message == "Tool Execution Failed" {
+			mark = utils.ColorRed + "✗" + utils.ColorReset
+		}
+		line := fmt.Sprintf("%s %s%s %s(%s)%s", mark, name, formatToolArgs(toolArgs[name]), utils.ColorDim, formatLogDuration(logDuration(entry)), utils.ColorReset)
+		if err := logField(entry, "error"); err != "" {
+			line += " " + utils.ColorRed + firstLine(err) + utils.ColorReset
+		}
+		return line
+	case "REPL command":
+		return "/" + logField(entry, "command")
+	case "LLM iteration", "Processing tool call", "Tool execution completed", "LLM requested tool calls",
+		"Starting tool-enabled LLM request", "LLM completed without tool calls":
+		return ""
+	}
+
+	line := entry.Message
+	for _, key := range []string{"model", "path", "tool_name", "reason", "error"} {
+		if value := logField(entry, key); value != "" {
+			line += " " + key + "=" + firstLine(value)
+		}
+	}
+	switch entry.Level {
+	case utils.ERROR:
+		return utils.ColorRed + line + utils.ColorReset
+	case utils.WARNING:
+		return utils.ColorYellow + line + utils.ColorReset
+	}
+	return line
+}
+
+// sessionMarkdown exports a session as a Markdown report
+func sessionMarkdown(session utils.LogSession, entries []utils.LogEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# go-code session %s\n\n", session.ID)
+	if len(entries) > 0 {
+		fmt.Fprintf(&b, "- Started: %s\n", entries[0].Time().Local().Format("2006-01-02 15:04:05 MST"))
+	}
+	fmt.Fprintf(&b, "- Entries: %d\n", len(entries))
+
+	setup, turns := splitTurns(entries)
+	for i, turn := range turns {
+		fmt.Fprintf(&b, "\n## Turn %d (%s, %s)\n\n", i+1, turn.start.Time().Local().Format("15:04:05"), formatLogDuration(turn.duration()))
+		b.WriteString("**User**\n\n")
+		b.WriteString(quoteMarkdown(logField(turn.start, "input")) + "\n\n")
+
+		toolArgs := map[string]interface{}{}
+		var tools []string
+		for _, entry := range turn.entries {
+			switch entry.Message {
+			case "Tool Call":
+				toolArgs[logField(entry, "tool_name")] = entry.Data["tool_args"]
+			case "Tool Execution Success", "Tool Execution Failed":
+				name := logField(entry, "tool_name")
+				status := "ok"
+				output := logField(entry, "result")
+				if entry.Message == "Tool Execution Failed" {
+					status = "failed"
+					output = logField(entry, "error")
+				}
+				args, _ := json.Marshal(toolArgs[name])
+				tools = append(tools, fmt.Sprintf("<details><summary><code>%s</code> %s, %s, %s</summary>\n\n```\n%s\n```\n\n</details>\n",
+					name, strings.ReplaceAll(string(args), "<", "&lt;"), status, formatLogDuration(logDuration(entry)), truncateLines(output, maxMarkdownResultLines)))
+			}
+		}
+		if len(tools) > 0 {
+			b.WriteString("**Tool calls**\n\n" + strings.Join(tools, "\n") + "\n")
+		}
+
+		if response, ok := turn.response(); ok {
+			fmt.Fprintf(&b, "**Assistant** (%s, %s)\n\n%s\n", logField(response, "model"), formatLogDuration(logDuration(response)), logField(response, "response"))
+		}
+	}
+
+	var problems []string
+	for _, entry := range entries {
+		if entry.Level == utils.WARNING || entry.Level == utils.ERROR {
+			line := fmt.Sprintf("- `%s` **%s** %s", entry.Time().Local().Format("15:04:05"), entry.Level, entry.Message)
+			if err := logField(entry, "error"); err != "" {
+				line += ": " + firstLine(err)
+			}
+			problems = append(problems, line)
+		}
+	}
+	if len(problems) > 0 {
+		b.WriteString("\n## Warnings and errors\n\n" + strings.Join(problems, "\n") + "\n")
+	}
+	if len(setup) > 0 && len(turns) == 0 {
+		b.WriteString("\nNo turns were logged in this session.\n")
+	}
+	return b.String()
+}
+
+// logField returns a data field of an entry as text
+func logField(entry utils.LogEntry, key string) string {
+	value, ok := entry.Data[key]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// logDuration reads the duration_ms field of an entry
+func logDuration(entry utils.LogEntry) time.Duration {
+	ms, _ := entry.Data["duration_ms"].(float64)
+	return time.Duration(ms) * time.Millisecond
+}
+
+func formatLogDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Round(time.Second).String()
+	}
+}
+
+// formatToolArgs renders tool arguments as key=value pairs
+func formatToolArgs(args interface{}) string {
+	values, ok := args.(map[string]interface{})
+	if !ok || len(values) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		value := firstLine(fmt.Sprint(values[key]))
+		if len([]rune(value)) > 60 {
+			value = string([]rune(value)[:59]) + "…"
+		}
+		parts = append(parts, key+"="+value)
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+func formatSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	if size < 1<<20 {
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+}
+
+// firstLine returns the first line of text, marking when more follows
+func firstLine(text string) string {
+	text = strings.TrimSpace(text)
+	if line, _, found := strings.Cut(text, "\n"); found {
+		return line + " …"
+	}
+	return text
+}
+
+func truncateLines(text string, limit int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) <= limit {
+		return strings.Join(lines, "\n")
+	}
+	return strings.Join(lines[:limit], "\n") + fmt.Sprintf("\n… %d more lines", len(lines)-limit)
+}
+
+func quoteMarkdown(text string) string {
+	return "> " + strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n> ")
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().StringVar(&logsLevel, "level", "", "Only show entries at this level or above")
+	logsCmd.Flags().StringVar(&logsCategory, "category", "", "Only show entries of this category (llm, tool, interaction, system)")
+	logsCmd.Flags().StringVar(&logsSince, "since", "", "Only show entries after a time or duration ago, e.g. 2h or 2025-01-31")
+	logsCmd.Flags().StringVar(&logsUntil, "until", "", "Only show entries before a time or duration ago")
+	logsCmd.Flags().BoolVar(&logsMarkdown, "markdown", false, "Export the session as Markdown, e.g. for a bug report")
+	logsCmd.Flags().StringVarP(&logsOutput, "output", "o", "", "Write to a file instead of stdout")
+}
@@ -4,12 +4,14 @@ Copyright © 2025 Kacem Mathlouthi <kacem.math47@gmail.com>
 package cmd
 
 import (
-	"bufio"
 	"fmt"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/checks"
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/lsp"
 	"github.com/KacemMathlouthi/go-code/utils"
 	"github.com/openai/openai-go"
 	"github.com/spf13/cobra"
@@ -22,79 +24,253 @@ var rootCmd = &cobra.Command{
 	Long: `A Coding Agent in the terminal. 
 	The agent can execute shell commands, read and write files, and more. 
 	It can contribute to your codebase by writing code, fixing bugs, and more.`,
-	Run: runInteractive,
+	PersistentPreRunE: setupColors,
+	Run:               runInteractive,
+}
+
+var (
+	maxIterations    int
+	oneShotPrompt    string
+	promptProfile    string
+	approveDiffs     bool
+	allowCommits     bool
+	autoCommit       bool
+	autoCommitBranch string
+	worktreeName     string
+	fullScreen       bool
+	colorMode        string
+	themeName        string
+
+	logLevel        string
+	consoleLogLevel string
+	verbose         bool
+	quiet           bool
+	logToStderr     bool
+
+	traceEnabled bool
+	traceFile    string
+	otlpEndpoint string
+
+	checksSpec string
+	// enabledChecks are the post-edit checks run after each file change
+	enabledChecks []string
+)
+
+// setupColors applies the color flags, falling back to GOCODE_COLOR and
+// GOCODE_THEME
+func setupColors(cmd *cobra.Command, args []string) error {
+	envConfig := config.LoadEnvConfig()
+	if !cmd.Flags().Changed("color") && envConfig.ColorMode != "" {
+		colorMode = envConfig.ColorMode
+	}
+	if themeName == "" {
+		themeName = envConfig.Theme
+	}
+	return utils.ConfigureColors(colorMode, themeName)
+}
+
+// loggerOptions resolves the logging flags. The console shows no logs in
+// interactive mode and warnings on stderr in one-shot mode unless asked.
+func loggerOptions(cmd *cobra.Command) (utils.LoggerOptions, error) {
+	if verbose && quiet {
+		return utils.LoggerOptions{}, fmt.Errorf("--verbose and --quiet can't be used together")
+	}
+
+	envConfig := config.LoadEnvConfig()
+	options := utils.LoggerOptions{
+		FileLevel:    utils.INFO,
+		ConsoleLevel: utils.OFF,
+		MaxSize:      int64(envConfig.LogMaxSizeMB) << 20,
+		MaxAge:       time.Duration(envConfig.LogMaxAgeDays) * 24 * time.Hour,
+		MaxFiles:     envConfig.LogMaxFiles,
+	}
+	if envConfig.LogLevel != "" && !cmd.Flags().Changed("log-level") {
+		logLevel = envConfig.LogLevel
+	}
+	if logLevel != "" {
+		level, err := utils.ParseLogLevel(logLevel)
+		if err != nil {
+			return options, err
+		}
+		options.FileLevel = level
+	}
+
+	if oneShotPrompt != "" {
+		options.ConsoleLevel = utils.WARNING
+		logToStderr = true
+	}
+	switch {
+	case consoleLogLevel != "":
+		level, err := utils.ParseLogLevel(consoleLogLevel)
+		if err != nil {
+			return options, err
+		}
+		options.ConsoleLevel = level
+	case verbose:
+		options.ConsoleLevel = utils.DEBUG
+	case quiet:
+		options.ConsoleLevel = utils.OFF
+	}
+	if logToStderr {
+		options.Console = os.Stderr
+	}
+	return options, nil
 }
 
 func runInteractive(cmd *cobra.Command, args []string) {
+	options, err := loggerOptions(cmd)
+	if err != nil {
+		fmt.Println(utils.FormatError(err.Error()))
+		os.Exit(1)
+	}
+
 	// Initialize logger
-	if err := utils.InitLogger(); err != nil {
+	if err := utils.InitLogger(options); err != nil {
 		fmt.Printf("Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
+	// Deferred first so it exits after the other deferred cleanup ran
+	failed := false
+	defer func() {
+		if failed {
+			os.Exit(1)
+		}
+	}()
 	defer utils.CloseLogger()
 
-	utils.GetStartupText()
-	scanner := bufio.NewScanner(os.Stdin)
-	conversationHistory := []openai.ChatCompletionMessageParamUnion{}
-
-	for {
-		fmt.Print(utils.FormatPrompt())
-		scanner.Scan()
-		input := strings.TrimSpace(scanner.Text())
+	if err := setupTracing(); err != nil {
+		fmt.Println(utils.FormatError(err.Error()))
+		os.Exit(1)
+	}
+	defer shutdownTracing()
+	defer lsp.Shutdown()
 
-		if strings.ToLower(input) == "--quit" {
-			fmt.Println(utils.ColorGreen + utils.ColorBold + "👋 Goodbye!" + utils.ColorReset)
-			break
+	var wt *worktree
+	if worktreeName != "" {
+		wt, err = openWorktree(worktreeName)
+		if err != nil {
+			fmt.Println(utils.FormatError(err.Error()))
+			os.Exit(1)
 		}
-
-		if strings.ToLower(input) == "--help" {
-			utils.GetHelpText()
-			continue
+		// Auto-commits go to the worktree's branch
+		if autoCommitBranch == "" {
+			autoCommitBranch = wt.branch
 		}
+	}
 
-		if strings.ToLower(input) == "--config" {
-			utils.GetConfigText()
-			continue
-		}
+	if maxIterations <= 0 {
+		maxIterations = config.LoadEnvConfig().MaxIterations
+	}
 
-		if strings.ToLower(input) == "--clear" {
-			conversationHistory = []openai.ChatCompletionMessageParamUnion{}
-			utils.ClearScreen()
-			continue
-		}
+	if checksSpec == "" {
+		checksSpec = config.LoadEnvConfig().Checks
+	}
+	if checksSpec == "" {
+		checksSpec = checks.DefaultChecks
+	}
+	if enabledChecks, err = checks.Parse(checksSpec); err != nil {
+		fmt.Println(utils.FormatError(err.Error()))
+		os.Exit(1)
+	}
 
-		if input == "" {
-			fmt.Println(utils.ColorYellow + "Please enter some text." + utils.ColorReset)
-			continue
+	if err := agent.SetPromptProfile(promptProfile); err != nil {
+		fmt.Println(utils.FormatError(err.Error()))
+		os.Exit(1)
+	}
+
+	committer, err := newAutoCommitter()
+	if err != nil {
+		fmt.Println(utils.FormatError(err.Error()))
+		os.Exit(1)
+	}
+
+	if oneShotPrompt != "" {
+		failed = runOneShot(oneShotPrompt, committer) != nil
+		if wt != nil {
+			// Only ask when someone is there to answer
+			var ask func(string) (string, error)
+			if utils.IsTerminal(os.Stdin) {
+				ask = utils.NewLineEditor("").ReadLine
+			}
+			wt.finish(ask)
 		}
+		return
+	}
 
-		// Log user input
-		utils.LogInfo("User input received", "interaction", map[string]interface{}{
-			"input_length":        len(input),
-			"conversation_length": len(conversationHistory),
-		})
+	s := newSession()
+	s.autoCommit = committer
+	if fullScreen {
+		if tuiAvailable() {
+			if err := runTUI(s); err != nil {
+				fmt.Println(utils.FormatError(err.Error()))
+				os.Exit(1)
+			}
+			if wt != nil {
+				wt.finish(s.editor.ReadLine)
+			}
+			return
+		}
+		fmt.Println(utils.ColorYellow + "The full-screen UI needs an interactive terminal, using line mode." + utils.ColorReset)
+	}
 
-		// Display user input in a formatted box
-		fmt.Println(utils.FormatUserInput(input))
+	utils.GetStartupText()
+	s.run()
+	if wt != nil {
+		wt.finish(s.editor.ReadLine)
+	}
+}
 
-		// Add user message to conversation history
-		conversationHistory = append(conversationHistory, openai.UserMessage(input))
+// runOneShot answers a single prompt without entering the REPL. The error is
+// already reported when returned.
+func runOneShot(prompt string, committer *autoCommitter) error {
+	utils.LogInfo("One-shot prompt received", "interaction", map[string]interface{}{
+		"input":          prompt,
+		"input_length":   len(prompt),
+		"max_iterations": maxIterations,
+	})
 
-		output, err := agent.GetLlmResponseWithTools(conversationHistory)
-		if err != nil {
-			utils.LogError("LLM response failed", "interaction", map[string]interface{}{
-				"error": err.Error(),
-			})
-			fmt.Println(utils.FormatError(err.Error()))
-			continue
+	ctx, span := startTurn("one-shot", prompt)
+	message, _ := agent.ExpandMentions(prompt)
+	history := []openai.ChatCompletionMessageParamUnion{openai.UserMessage(message)}
+	loop := agent.LoopConfig{MaxIterations: maxIterations, Context: ctx, Check: postEditCheck()}
+	// Nobody can be asked, so commits need --allow-commits
+	loop.ApproveTool = func(toolName string, toolArgs map[string]string) bool {
+		return toolName != "git_commit" || commitsAllowed()
+	}
+	if committer != nil {
+		committer.beginTurn()
+		loop.Snapshot = committer.track
+		// Keep stdout for the answer
+		committer.out = os.Stderr
+	}
+	output, err := agent.GetLlmResponseWithTools(history, loop)
+	span.SetAttribute("output.length", len(output))
+	endTurn(span, err)
+	if err != nil {
+		utils.LogError("LLM response failed", "interaction", map[string]interface{}{
+			"error": err.Error(),
+		})
+		fmt.Println(utils.FormatError(err.Error()))
+		if committer != nil {
+			committer.finishTurn(ctx, prompt)
 		}
+		return err
+	}
+	fmt.Println(output)
+	if committer != nil {
+		committer.finishTurn(ctx, prompt)
+	}
+	return nil
+}
 
-		// Add assistant response to conversation history
-		conversationHistory = append(conversationHistory, openai.AssistantMessage(output))
-
-		// Display AI response in a formatted box with markdown rendering
-		fmt.Println(utils.FormatAIResponse(output))
-		fmt.Println()
+// postEditCheck returns the LoopConfig.Check running the enabled checks, nil
+// when they are disabled
+func postEditCheck() func(paths []string) string {
+	if len(enabledChecks) == 0 {
+		return nil
+	}
+	return func(paths []string) string {
+		return checks.Run(enabledChecks, paths)
 	}
 }
 
@@ -116,5 +292,25 @@ func init() {
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	rootCmd.PersistentFlags().StringVar(&colorMode, "color", utils.ColorAuto, "When to use colors: auto, always or never (auto honors NO_COLOR)")
+	rootCmd.PersistentFlags().StringVar(&themeName, "theme", "", "Color theme: dark, light, high-contrast or a custom <config dir>/themes/<name>.json (default $GOCODE_THEME or dark)")
+
+	rootCmd.Flags().IntVar(&maxIterations, "max-iterations", 0, "Tool loop steps allowed per turn (default $GOCODE_MAX_ITERATIONS or 25)")
+	rootCmd.Flags().StringVar(&promptProfile, "prompt-profile", agent.DefaultPromptProfile, "Named system prompt profile from <config dir>/prompts/<name>.tmpl")
+	rootCmd.Flags().BoolVar(&approveDiffs, "approve-diffs", false, "Ask for approval of each file change before it is written, of each rename and of each commit")
+	rootCmd.Flags().BoolVar(&allowCommits, "allow-commits", false, "Let the agent create commits with git_commit without asking (default $GOCODE_ALLOW_COMMITS)")
+	rootCmd.Flags().BoolVar(&autoCommit, "auto-commit", false, "Commit the files changed by each turn with a generated message (default $GOCODE_AUTO_COMMIT)")
+	rootCmd.Flags().StringVar(&autoCommitBranch, "auto-commit-branch", "", "Branch of the auto-commits (default $GOCODE_AUTO_COMMIT_BRANCH or go-code/<session id>)")
+	rootCmd.Flags().StringVar(&worktreeName, "worktree", "", "Run the session in a git worktree on the new branch go-code/<name>, leaving the working copy untouched")
+	rootCmd.Flags().StringVar(&checksSpec, "checks", "", "Checks run after each file change, reported to the model: gofmt, build, vet, lsp or none (default $GOCODE_CHECKS or "+checks.DefaultChecks+")")
+	rootCmd.Flags().BoolVar(&fullScreen, "tui", false, "Use the full-screen terminal UI instead of line mode")
+	rootCmd.Flags().StringVar(&logLevel, "log-level", "", "Minimum level written to the log file: debug, info, warning, error or off (default $GOCODE_LOG_LEVEL or info)")
+	rootCmd.Flags().StringVar(&consoleLogLevel, "console-log-level", "", "Minimum level printed to the console (default off, warning with --prompt)")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Print all logs, with their data, to the console")
+	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Print no logs to the console")
+	rootCmd.Flags().BoolVar(&logToStderr, "log-stderr", false, "Print console logs to stderr instead of stdout")
+	rootCmd.Flags().BoolVar(&traceEnabled, "trace", false, "Record spans to <state dir>/traces/<session>.json, viewable in Perfetto or chrome://tracing")
+	rootCmd.Flags().StringVar(&traceFile, "trace-file", "", "Record spans to this file (default $GOCODE_TRACE_FILE)")
+	rootCmd.Flags().StringVar(&otlpEndpoint, "otlp-endpoint", "", "Export spans to an OpenTelemetry collector over OTLP/HTTP (default $OTEL_EXPORTER_OTLP_TRACES_ENDPOINT)")
+	rootCmd.Flags().StringVarP(&oneShotPrompt, "prompt", "p", "", "Run a single prompt non-interactively and print the answer")
 }
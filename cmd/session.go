@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/checkpoint"
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/utils"
+	"github.com/openai/openai-go"
+)
+
+// errQuit is returned by a command to end the REPL
+var errQuit = errors.New("quit")
+
+// usageStats accumulates token usage for the session
+type usageStats struct {
+	Requests         int
+	PromptTokens     int64
+	CompletionTokens int64
+	ByModel          map[string]int64
+}
+
+// savedMessage is a conversation message as stored in a session file
+type savedMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// savedSession is the on-disk format of /save and /resume
+type savedSession struct {
+	Name     string         `json:"name"`
+	SavedAt  string         `json:"saved_at"`
+	Model    string         `json:"model"`
+	Messages []savedMessage `json:"messages"`
+}
+
+// session holds the state of an interactive REPL
+type session struct {
+	editor   *utils.LineEditor
+	activity *utils.ToolActivity
+	loop     agent.LoopConfig
+	commands *commandRegistry
+	// ask reads the answer to a question, from the line editor by default
+	ask func(prompt string) (string, error)
+	// observer, when set, also receives the tool loop events
+	observer func(agent.Event)
+	// autoCommit, when set, commits the files changed by each turn
+	autoCommit *autoCommitter
+	// checkpoints snapshots the files changed by each turn, nil when the
+	// state directory is unavailable
+	checkpoints *checkpoint.Store
+
+	// messages mirrors the conversation history so it can be saved
+	messages []savedMessage
+	history  []openai.ChatCompletionMessageParamUnion
+	usage    usageStats
+}
+
+func newSession() *session {
+	s := &session{
+		editor:   utils.NewLineEditor(historyPath()),
+		activity: utils.NewToolActivity(),
+		usage:    usageStats{ByModel: map[string]int64{}},
+	}
+	s.commands = newCommandRegistry()
+	s.checkpoints = openCheckpoints()
+	s.editor.Completer = s.complete
+	s.ask = s.editor.ReadLine
+
+	s.loop = agent.LoopConfig{
+		MaxIterations: maxIterations,
+		OnEvent:       s.handleEvent,
+		Check:         postEditCheck(),
+		Continue: func(stepsUsed int) bool {
+			return s.confirm(utils.FormatContinuePrompt(stepsUsed))
+		},
+	}
+	s.loop.Snapshot = s.snapshot
+	approveAll := approveDiffs || config.LoadEnvConfig().ApproveDiffs
+	if approveAll {
+		s.loop.ApproveDiff = func(path, diff string) bool {
+			return s.confirm(utils.FormatApprovalPrompt("Apply this change to " + path + "?"))
+		}
+	}
+	// Commits are always asked for unless allowed, other tools only with
+	// --approve-diffs
+	s.loop.ApproveTool = func(toolName string, toolArgs map[string]string) bool {
+		if !approveAll && (toolName != "git_commit" || commitsAllowed()) {
+			return true
+		}
+		return s.confirm(utils.FormatApprovalPrompt(fmt.Sprintf("Allow %s? %s", toolName, utils.DescribeToolCall(toolName, toolArgs))))
+	}
+	return s
+}
+
+// commitsAllowed reports whether git_commit may run without asking
+func commitsAllowed() bool {
+	return allowCommits || config.LoadEnvConfig().AllowCommits
+}
+
+// run reads and handles input until the user quits
+func (s *session) run() {
+	for {
+		line, err := s.editor.ReadLine(utils.FormatPrompt())
+		if err == utils.ErrInterrupted {
+			continue
+		}
+		if err != nil {
+			fmt.Println(utils.ColorGreen + utils.ColorBold + "👋 Goodbye!" + utils.ColorReset)
+			return
+		}
+		if !s.handleInput(line) {
+			return
+		}
+	}
+}
+
+// handleInput runs a slash command or sends a message, and returns false when
+// the user quits
+func (s *session) handleInput(line string) bool {
+	input := strings.TrimSpace(line)
+	s.editor.AddHistory(input)
+
+	if input == "" {
+		fmt.Println(utils.ColorYellow + "Please enter some text." + utils.ColorReset)
+		return true
+	}
+
+	if strings.HasPrefix(input, "/") {
+		if err := s.commands.execute(s, input); err != nil {
+			if err == errQuit {
+				fmt.Println(utils.ColorGreen + utils.ColorBold + "👋 Goodbye!" + utils.ColorReset)
+				return false
+			}
+			fmt.Println(utils.FormatError(err.Error()))
+		}
+		return true
+	}
+
+	s.send(input)
+	return true
+}
+
+// send adds a user message to the conversation and prints the agent's answer
+func (s *session) send(input string) {
+	// Log user input
+	utils.LogInfo("User input received", "interaction", map[string]interface{}{
+		"input":               input,
+		"input_length":        len(input),
+		"conversation_length": len(s.history),
+	})
+	start := time.Now()
+
+	// Display user input in a formatted box
+	fmt.Println(utils.FormatUserInput(input))
+
+	// Attach the files and directories mentioned with @path
+	message, attachments := agent.ExpandMentions(input)
+	printAttachments(attachments)
+
+	// Add user message to conversation history
+	s.history = append(s.history, openai.UserMessage(message))
+	s.messages = append(s.messages, savedMessage{Role: "user", Content: message})
+	s.activity.Reset()
+	if s.checkpoints != nil {
+		s.checkpoints.Begin(input)
+	}
+	if s.autoCommit != nil {
+		s.autoCommit.beginTurn()
+	}
+
+	ctx, span := startTurn("interactive", input)
+	loop := s.loop
+	loop.Context = ctx
+	output, err := agent.GetLlmResponseWithTools(s.history, loop)
+	span.SetAttribute("output.length", len(output))
+	span.SetAttribute("conversation.length", len(s.history))
+	endTurn(span, err)
+	if err != nil {
+		utils.LogError("LLM response failed", "interaction", map[string]interface{}{
+			"error": err.Error(),
+		})
+		fmt.Println(utils.FormatError(err.Error()))
+		s.commitTurn(ctx, input)
+		return
+	}
+
+	// Add assistant response to conversation history
+	s.history = append(s.history, openai.AssistantMessage(output))
+	s.messages = append(s.messages, savedMessage{Role: "assistant", Content: output})
+	utils.LogInfo("Turn completed", "interaction", map[string]interface{}{
+		"duration":        time.Since(start).String(),
+		"duration_ms":     time.Since(start).Milliseconds(),
+		"response_length": len(output),
+	})
+
+	// Display AI response with markdown rendering
+	fmt.Println(utils.FormatAIResponse(output))
+	fmt.Println()
+	s.commitTurn(ctx, input)
+}
+
+// snapshot saves a file before a tool changes it, for /undo and for the
+// auto-commit of the turn
+func (s *session) snapshot(path string) error {
+	if s.checkpoints != nil {
+		if err := s.checkpoints.Snapshot(path); err != nil {
+			return err
+		}
+	}
+	if s.autoCommit != nil {
+		s.autoCommit.track(path)
+	}
+	return nil
+}
+
+// commitTurn auto-commits the files changed by the turn, when enabled
+func (s *session) commitTurn(ctx context.Context, input string) {
+	if s.autoCommit != nil {
+		s.autoCommit.finishTurn(ctx, input)
+	}
+}
+
+// printAttachments lists the @path mentions attached to a message
+func printAttachments(attachments []agent.Attachment) {
+	for _, attachment := range attachments {
+		switch {
+		case attachment.Skipped != "":
+			fmt.Println(utils.ColorYellow + "📎 Skipped " + attachment.Path + ": " + attachment.Skipped + utils.ColorReset)
+		case attachment.IsDir:
+			fmt.Println(utils.ColorDim + "📎 Attached listing of " + attachment.Path + utils.ColorReset)
+		default:
+			note := ""
+			if attachment.Truncated {
+				note = ", truncated"
+			}
+			fmt.Println(utils.ColorDim + fmt.Sprintf("📎 Attached %s (%.1f KB%s)", attachment.Path, float64(attachment.Size)/1024, note) + utils.ColorReset)
+		}
+	}
+}
+
+// handleEvent renders tool loop events and tracks token usage
+func (s *session) handleEvent(event agent.Event) {
+	switch event.Type {
+	case agent.EventToolStart:
+		s.activity.Start(event.ToolName, event.ToolArgs)
+	case agent.EventToolEnd:
+		s.activity.Finish(event.Result, event.Err, event.Duration)
+	case agent.EventFileDiff:
+		if event.Diff != "" {
+			// The change is shown as is when it has to be approved
+			fmt.Print(utils.FormatDiff(event.Diff, s.loop.ApproveDiff != nil))
+		}
+	case agent.EventLLMResponse:
+		s.usage.Requests++
+		s.usage.PromptTokens += event.Usage.PromptTokens
+		s.usage.CompletionTokens += event.Usage.CompletionTokens
+		s.usage.ByModel[event.Model] += event.Usage.TotalTokens
+	}
+	if s.observer != nil {
+		s.observer(event)
+	}
+}
+
+// clear forgets the conversation
+func (s *session) clear() {
+	s.history = nil
+	s.messages = nil
+	agent.ResetProjectSnapshot()
+}
+
+// confirm asks a yes/no question, defaulting to no
+func (s *session) confirm(prompt string) bool {
+	answer, err := s.ask(prompt)
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// save writes the conversation to the sessions directory
+func (s *session) save(name string) (string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = time.Now().Format("20060102-150405")
+	}
+
+	data, err := json.MarshalIndent(savedSession{
+		Name:     name,
+		SavedAt:  time.Now().Format(time.RFC3339),
+		Model:    agent.CurrentModel(),
+		Messages: s.messages,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path, err := sessionFile(dir, name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to save session: %v", err)
+	}
+	return path, nil
+}
+
+// resume replaces the conversation with a saved session
+func (s *session) resume(name string) (int, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return 0, err
+	}
+	path, err := sessionFile(dir, name)
+	if err != nil {
+		return 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("session %q not found", name)
+	}
+
+	var saved savedSession
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("failed to read session %q: %v", name, err)
+	}
+
+	s.clear()
+	for _, message := range saved.Messages {
+		switch message.Role {
+		case "user":
+			s.history = append(s.history, openai.UserMessage(message.Content))
+		case "assistant":
+			s.history = append(s.history, openai.AssistantMessage(message.Content))
+		default:
+			continue
+		}
+		s.messages = append(s.messages, message)
+	}
+	return len(s.messages), nil
+}
+
+// sessionFile returns the file of a saved session in dir, rejecting names that
+// would point outside of it
+func sessionFile(dir, name string) (string, error) {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || filepath.Base(name) != name {
+		return "", fmt.Errorf("invalid session name %q, it must not contain a path", name)
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// savedSessionNames lists the saved sessions, most recent first
+func savedSessionNames() ([]string, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type named struct {
+		name    string
+		modTime time.Time
+	}
+	var found []named
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, named{strings.TrimSuffix(entry.Name(), ".json"), info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.After(found[j].modTime) })
+
+	names := make([]string, len(found))
+	for i, f := range found {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+// sessionsDir returns the directory of saved sessions, creating it if needed
+func sessionsDir() (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "sessions")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// historyPath returns the REPL history file in the state directory, or an
+// empty path (no persistent history) when it can't be created
+func historyPath() string {
+	dir, err := config.StateDir()
+	if err != nil {
+		return ""
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "history")
+}
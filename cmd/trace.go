@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/tracing"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// setupTracing enables the exporters asked for by the flags, falling back to
+// GOCODE_TRACE_FILE and the OTEL_EXPORTER_OTLP_* variables
+func setupTracing() error {
+	envConfig := config.LoadEnvConfig()
+	if traceFile == "" {
+		traceFile = envConfig.TraceFile
+	}
+	if otlpEndpoint == "" {
+		otlpEndpoint = envConfig.OTLPEndpoint
+	}
+
+	if traceFile == "" && traceEnabled {
+		dir, err := config.TraceDir()
+		if err != nil {
+			return err
+		}
+		traceFile = filepath.Join(dir, utils.SessionID()+".json")
+	}
+	if traceFile != "" {
+		exporter, err := tracing.NewFileExporter(traceFile)
+		if err != nil {
+			return err
+		}
+		tracing.AddExporter(exporter)
+	}
+	if otlpEndpoint != "" {
+		exporter, err := tracing.NewOTLPExporter(otlpEndpoint, envConfig.OTLPHeaders)
+		if err != nil {
+			return err
+		}
+		tracing.AddExporter(exporter)
+	}
+
+	if tracing.Enabled() {
+		utils.LogInfo("Tracing enabled", "system", map[string]interface{}{
+			"trace_file":    traceFile,
+			"otlp_endpoint": otlpEndpoint,
+		})
+	}
+	return nil
+}
+
+// startTurn opens the span of a user turn
+func startTurn(mode, input string) (context.Context, *tracing.Span) {
+	return tracing.Start(context.Background(), "agent.turn", tracing.KindInternal, map[string]interface{}{
+		"session.id":   utils.SessionID(),
+		"turn.mode":    mode,
+		"input.length": len(input),
+		"llm.model":    agent.CurrentModel(),
+	})
+}
+
+// endTurn closes the span of a turn and exports the spans recorded so far
+func endTurn(span *tracing.Span, err error) {
+	span.SetError(err)
+	span.Finish()
+	flushTraces()
+}
+
+// flushTraces exports the finished spans, logging failures rather than
+// interrupting the session
+func flushTraces() {
+	if err := tracing.Flush(); err != nil {
+		utils.LogWarning("Failed to export traces", "system", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// shutdownTracing exports the remaining spans and closes the exporters
+func shutdownTracing() {
+	if err := tracing.Shutdown(); err != nil {
+		utils.LogWarning("Failed to export traces", "system", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/agent"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// tuiAvailable reports whether the full-screen UI can run, which needs an
+// interactive terminal that understands cursor movement
+func tuiAvailable() bool {
+	return utils.IsTerminal(os.Stdin) && utils.IsTerminal(os.Stdout) && os.Getenv("TERM") != "dumb"
+}
+
+// runTUI runs the session in the full-screen UI
+func runTUI(s *session) error {
+	ui := &utils.TUI{
+		Started:   utils.GetStartupText,
+		Completer: s.complete,
+		History:   s.editor.History(),
+	}
+	ui.Submit = func(input string) bool {
+		keepGoing := s.handleInput(input)
+		ui.SetStatus(s.status())
+		return keepGoing
+	}
+
+	// The activity panel shows running tools, so the pane only gets the results
+	s.activity.SetAnimated(false)
+	s.ask = ui.Ask
+	s.observer = func(event agent.Event) {
+		switch event.Type {
+		case agent.EventToolStart:
+			ui.ToolStarted(utils.DescribeToolCall(event.ToolName, event.ToolArgs))
+		case agent.EventToolEnd:
+			ui.ToolFinished(event.Err, event.Duration)
+		case agent.EventLLMResponse:
+			ui.SetStatus(s.status())
+		}
+	}
+
+	ui.SetStatus(s.status())
+	return ui.Run()
+}
+
+// status collects the information shown in the status bar
+func (s *session) status() utils.TUIStatus {
+	status := utils.TUIStatus{
+		Model:  agent.CurrentModel(),
+		Tokens: s.usage.PromptTokens + s.usage.CompletionTokens,
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(cwd, home) {
+			cwd = "~" + strings.TrimPrefix(cwd, home)
+		}
+		status.Cwd = cwd
+	}
+	if branch, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output(); err == nil {
+		status.GitBranch = strings.TrimSpace(string(branch))
+	}
+	return status
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/lsp"
+	"github.com/KacemMathlouthi/go-code/tools"
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// worktree is the git worktree a --worktree session runs in
+type worktree struct {
+	name   string
+	branch string
+	path   string
+	// repoRoot is the working copy go-code was started in, and base the branch
+	// checked out there, empty when HEAD is detached
+	repoRoot string
+	base     string
+	// startDir is the directory go-code was started in
+	startDir string
+}
+
+// openWorktree creates the worktree name on the new branch go-code/<name>, or
+// reuses it when it was kept by a previous session, and moves into it so the
+// tools and the system prompt use it as their root
+func openWorktree(name string) (*worktree, error) {
+	startDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	root, err := tools.RunGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("--worktree needs a git repository: %v", err)
+	}
+	w := &worktree{
+		name:     name,
+		branch:   "go-code/" + name,
+		repoRoot: strings.TrimSpace(root),
+		startDir: startDir,
+	}
+	if _, err := tools.RunGit("check-ref-format", "--branch", w.branch); err != nil {
+		return nil, fmt.Errorf("invalid worktree name %q", name)
+	}
+	base, _ := tools.RunGit("symbolic-ref", "--quiet", "--short", "HEAD")
+	w.base = strings.TrimSpace(base)
+
+	dir, err := config.WorktreeDir()
+	if err != nil {
+		return nil, err
+	}
+	w.path = filepath.Join(dir, filepath.Base(w.repoRoot), strings.ReplaceAll(name, "/", "-"))
+
+	if existing, ok := w.registeredBranch(); ok {
+		w.branch = existing
+		fmt.Println(utils.ColorDim + "Reusing worktree " + w.path + " on branch " + w.branch + utils.ColorReset)
+	} else if err := w.create(); err != nil {
+		return nil, err
+	}
+
+	// Start in the same subdirectory of the repository
+	target := w.path
+	if rel, err := filepath.Rel(w.repoRoot, startDir); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		if info, err := os.Stat(filepath.Join(w.path, rel)); err == nil && info.IsDir() {
+			target = filepath.Join(w.path, rel)
+		}
+	}
+	if err := os.Chdir(target); err != nil {
+		return nil, err
+	}
+	utils.LogInfo("Session running in worktree", "git", map[string]interface{}{
+		"worktree": w.path,
+		"branch":   w.branch,
+		"base":     w.base,
+	})
+	return w, nil
+}
+
+// registeredBranch reports whether the worktree path is already a worktree of
+// the repository, and the branch it has checked out
+func (w *worktree) registeredBranch() (string, bool) {
+	list, err := tools.RunGitIn(w.repoRoot, "worktree", "list", "--porcelain")
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range strings.Split(list, "\n\n") {
+		var path, branch string
+		for _, line := range strings.Split(entry, "\n") {
+			if value, ok := strings.CutPrefix(line, "worktree "); ok {
+				path = value
+			}
+			if value, ok := strings.CutPrefix(line, "branch "); ok {
+				branch = strings.TrimPrefix(value, "refs/heads/")
+			}
+		}
+		if path == w.path && branch != "" {
+			return branch, true
+		}
+	}
+	return "", false
+}
+
+func (w *worktree) create() error {
+	if _, err := os.Stat(w.path); err == nil {
+		return fmt.Errorf("%s already exists and is not a worktree of %s", w.path, w.repoRoot)
+	}
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+
+	args := []string{"worktree", "add", "-b", w.branch, w.path}
+	if _, err := tools.RunGitIn(w.repoRoot, "rev-parse", "--verify", "--quiet", "refs/heads/"+w.branch); err == nil {
+		// The branch of a removed worktree is checked out again
+		args = []string{"worktree", "add", w.path, w.branch}
+	}
+	if _, err := tools.RunGitIn(w.repoRoot, args...); err != nil {
+		return err
+	}
+	fmt.Println(utils.ColorDim + "Created worktree " + w.path + " on branch " + w.branch + utils.ColorReset)
+	return nil
+}
+
+// finish goes back to the starting directory and asks whether to keep, merge
+// or remove the worktree. Without ask, the worktree is kept.
+func (w *worktree) finish(ask func(prompt string) (string, error)) {
+	// The language servers run in the worktree, which may be removed
+	lsp.Shutdown()
+	os.Chdir(w.startDir)
+
+	status, err := tools.RunGitIn(w.path, "status", "--porcelain")
+	if err != nil {
+		fmt.Println(utils.FormatError(err.Error()))
+		return
+	}
+	dirty := strings.TrimSpace(status) != ""
+	commits := "0"
+	if w.base != "" {
+		count, _ := tools.RunGitIn(w.repoRoot, "rev-list", "--count", w.base+".."+w.branch)
+		commits = strings.TrimSpace(count)
+	}
+
+	summary := fmt.Sprintf("Worktree %s (branch %s): %s new commit(s)", w.path, w.branch, commits)
+	if dirty {
+		summary += ", uncommitted changes"
+	}
+	fmt.Println(utils.ColorYellow + summary + utils.ColorReset)
+
+	choice := "keep"
+	if ask != nil {
+		target := w.base
+		if target == "" {
+			target = "the detached HEAD"
+		}
+		question := fmt.Sprintf("❓ Keep, merge into %s or remove the worktree? [K/m/r] ", target)
+		answer, err := ask(utils.ColorYellow + utils.ColorBold + question + utils.ColorReset)
+		if err == nil {
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "m", "merge":
+				choice = "merge"
+			case "r", "remove":
+				choice = "remove"
+			}
+		}
+	}
+
+	switch choice {
+	case "merge":
+		if dirty {
+			fmt.Println(utils.ColorYellow + "Uncommitted changes of the worktree:" + utils.ColorReset)
+			fmt.Print(status)
+			answer, _ := ask(utils.FormatApprovalPrompt("Commit them to " + w.branch + " before merging?"))
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				choice = "keep"
+				break
+			}
+		}
+		err = w.merge(dirty)
+	case "remove":
+		if (dirty || commits != "0") && ask != nil {
+			answer, _ := ask(utils.FormatApprovalPrompt("Discard the changes of " + w.branch + "?"))
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				choice = "keep"
+				break
+			}
+		}
+		err = w.remove(true)
+	}
+	if choice == "keep" {
+		fmt.Println(utils.ColorGreen + "Kept the worktree, continue with --worktree " + w.name + " or merge branch " + w.branch + "." + utils.ColorReset)
+	}
+	if err != nil {
+		utils.LogError("Worktree "+choice+" failed", "git", map[string]interface{}{
+			"worktree": w.path,
+			"error":    err.Error(),
+		})
+		fmt.Println(utils.FormatError(err.Error() + "\nThe worktree was kept at " + w.path + "."))
+		return
+	}
+	utils.LogInfo("Worktree closed", "git", map[string]interface{}{
+		"worktree": w.path,
+		"branch":   w.branch,
+		"action":   choice,
+	})
+}
+
+// merge commits the pending changes of the worktree, merges its branch into
+// the starting working copy, then removes the worktree
+func (w *worktree) merge(dirty bool) error {
+	if dirty {
+		if _, err := tools.RunGitIn(w.path, "add", "-A"); err != nil {
+			return err
+		}
+		if _, err := tools.RunGitIn(w.path, "commit", "-m", "chore: changes from go-code worktree "+w.name); err != nil {
+			return err
+		}
+	}
+	if _, err := tools.RunGitIn(w.repoRoot, "merge", "--no-edit", w.branch); err != nil {
+		// Leave the working copy as it was
+		tools.RunGitIn(w.repoRoot, "merge", "--abort")
+		return err
+	}
+	fmt.Println(utils.ColorGreen + "Merged " + w.branch + " into " + w.repoRoot + "." + utils.ColorReset)
+	return w.remove(false)
+}
+
+// remove deletes the worktree and its branch. Unless force is set the branch
+// is only deleted once merged.
+func (w *worktree) remove(force bool) error {
+	if _, err := tools.RunGitIn(w.repoRoot, "worktree", "remove", "--force", w.path); err != nil {
+		return err
+	}
+	deleteFlag := "-d"
+	if force {
+		deleteFlag = "-D"
+	}
+	if _, err := tools.RunGitIn(w.repoRoot, "branch", deleteFlag, w.branch); err != nil {
+		return err
+	}
+	fmt.Println(utils.ColorGreen + "Removed the worktree and branch " + w.branch + "." + utils.ColorReset)
+	return nil
+}
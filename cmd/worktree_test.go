@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KacemMathlouthi/go-code/tools"
+)
+
+// initRepository creates a repository with one commit on main, moves
+// into it and keeps the worktrees in a temporary state directory
+func initRepository(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	tempDir := func() string {
+		dir, err := filepath.EvalSymlinks(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	repo := tempDir()
+	t.Chdir(repo)
+	t.Setenv("GOCODE_STATE_DIR", tempDir())
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	for _, args := range [][]string{{"init", "-q", "-b", "main"}, {"commit", "-q", "--allow-empty", "-m", "initial"}} {
+		if _, err := tools.RunGit(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo
+}
+
+// answers returns an ask function giving the answers in order
+func answers(replies ...string) func(string) (string, error) {
+	return func(string) (string, error) {
+		if len(replies) == 0 {
+			return "", nil
+		}
+		reply := replies[0]
+		replies = replies[1:]
+		return reply, nil
+	}
+}
+
+func TestOpenWorktree(t *testing.T) {
+	repo := initRepository(t)
+
+	w, err := openWorktree("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cwd, _ := os.Getwd(); cwd != w.path || w.branch != "go-code/feature" || w.base != "main" || w.repoRoot != repo {
+		t.Errorf("openWorktree() = %+v in %s, want a worktree on go-code/feature from main", w, cwd)
+	}
+
+	// A kept worktree is found again, on the branch it has checked out
+	os.Chdir(repo)
+	if _, err := tools.RunGitIn(w.path, "switch", "-q", "-c", "renamed"); err != nil {
+		t.Fatal(err)
+	}
+	again, err := openWorktree("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.path != w.path || again.branch != "renamed" {
+		t.Errorf("reopened worktree = %+v, want %s on branch renamed", again, w.path)
+	}
+
+	if _, err := openWorktree("bad..name"); err == nil {
+		t.Errorf("openWorktree() with an invalid branch name succeeded")
+	}
+}
+
+func TestWorktreeFinish(t *testing.T) {
+	tests := []struct {
+		name        string
+		replies     []string
+		wantMerged  bool
+		wantRemoved bool
+	}{
+		{"keep", []string{""}, false, false},
+		{"merge", []string{"m", "y"}, true, true},
+		{"merge declined", []string{"m", "n"}, false, false},
+		{"remove", []string{"r", "y"}, false, true},
+		{"remove declined", []string{"r", "n"}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo := initRepository(t)
+			w, err := openWorktree("task")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(w.path, "notes.md"), []byte("notes\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			w.finish(answers(test.replies...))
+
+			if cwd, _ := os.Getwd(); cwd != repo {
+				t.Errorf("directory after finish = %s, want %s", cwd, repo)
+			}
+			if _, err := os.Stat(filepath.Join(repo, "notes.md")); (err == nil) != test.wantMerged {
+				t.Errorf("notes.md in the working copy = %v, want %v", err == nil, test.wantMerged)
+			}
+			if _, err := os.Stat(w.path); (err != nil) != test.wantRemoved {
+				t.Errorf("worktree removed = %v, want %v", err != nil, test.wantRemoved)
+			}
+			branches, _ := tools.RunGit("branch", "--list", w.branch)
+			if (strings.TrimSpace(branches) == "") != test.wantRemoved {
+				t.Errorf("branch %s deleted = %v, want %v", w.branch, strings.TrimSpace(branches) == "", test.wantRemoved)
+			}
+		})
+	}
+}
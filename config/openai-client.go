@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/openai/openai-go"
@@ -10,25 +12,122 @@ import (
 
 var openAIClient *openai.Client
 
+// DefaultModel is used when no deployment name is configured
+const DefaultModel = string(openai.ChatModelGPT4_1Mini)
+
+// DefaultMaxIterations is the number of tool loop steps allowed per turn
+// when GOCODE_MAX_ITERATIONS is not set
+const DefaultMaxIterations = 25
+
 // AzureOpenAIConfig
 type AzureOpenAIConfig struct {
-	APIVersion     string
-	Endpoint       string
-	APIKey         string
-	DeploymentName string
+	APIVersion          string
+	Endpoint            string
+	APIKey              string
+	DeploymentName      string
+	FallbackDeployments []string
+	MaxIterations       int
+	ApproveDiffs        bool
+	// AllowCommits lets git_commit run without asking
+	AllowCommits bool
+	// Theme and ColorMode select the terminal colors, see utils.ConfigureColors
+	Theme     string
+	ColorMode string
+	// LogLevel is the minimum level written to the log file
+	LogLevel string
+	// Log rotation and retention, zero when not set
+	LogMaxSizeMB  int
+	LogMaxAgeDays int
+	LogMaxFiles   int
+	// TraceFile is the local trace file, see the --trace-file flag
+	TraceFile string
+	// OTLPEndpoint and OTLPHeaders configure the export of spans to an
+	// OpenTelemetry collector over OTLP/HTTP
+	OTLPEndpoint string
+	OTLPHeaders  string
+	// AutoCommit commits each turn that changed files on AutoCommitBranch
+	AutoCommit       bool
+	AutoCommitBranch string
+	// Checks are the post-edit checks, comma separated, empty for the default
+	Checks string
 }
 
 func LoadEnvConfig() *AzureOpenAIConfig {
 	_ = godotenv.Load()
 	config := &AzureOpenAIConfig{
-		APIVersion:     os.Getenv("AZURE_API_VERSION"),
-		Endpoint:       os.Getenv("AZURE_ENDPOINT"),
-		APIKey:         os.Getenv("AZURE_API_KEY"),
-		DeploymentName: os.Getenv("AZURE_DEPLOYMENT_NAME"),
+		APIVersion:          os.Getenv("AZURE_API_VERSION"),
+		Endpoint:            os.Getenv("AZURE_ENDPOINT"),
+		APIKey:              os.Getenv("AZURE_API_KEY"),
+		DeploymentName:      os.Getenv("AZURE_DEPLOYMENT_NAME"),
+		FallbackDeployments: splitList(os.Getenv("AZURE_FALLBACK_DEPLOYMENTS")),
+		MaxIterations:       DefaultMaxIterations,
+		Theme:               os.Getenv("GOCODE_THEME"),
+		ColorMode:           os.Getenv("GOCODE_COLOR"),
+		LogLevel:            os.Getenv("GOCODE_LOG_LEVEL"),
+	}
+	if n, err := strconv.Atoi(os.Getenv("GOCODE_MAX_ITERATIONS")); err == nil && n > 0 {
+		config.MaxIterations = n
+	}
+	if approve, err := strconv.ParseBool(os.Getenv("GOCODE_APPROVE_DIFFS")); err == nil {
+		config.ApproveDiffs = approve
+	}
+	if allow, err := strconv.ParseBool(os.Getenv("GOCODE_ALLOW_COMMITS")); err == nil {
+		config.AllowCommits = allow
+	}
+	if autoCommit, err := strconv.ParseBool(os.Getenv("GOCODE_AUTO_COMMIT")); err == nil {
+		config.AutoCommit = autoCommit
+	}
+	config.AutoCommitBranch = os.Getenv("GOCODE_AUTO_COMMIT_BRANCH")
+	config.Checks = os.Getenv("GOCODE_CHECKS")
+	config.LogMaxSizeMB, _ = strconv.Atoi(os.Getenv("GOCODE_LOG_MAX_SIZE_MB"))
+	config.LogMaxAgeDays, _ = strconv.Atoi(os.Getenv("GOCODE_LOG_MAX_AGE_DAYS"))
+	config.LogMaxFiles, _ = strconv.Atoi(os.Getenv("GOCODE_LOG_MAX_FILES"))
+
+	// Standard OpenTelemetry variables: the signal specific endpoint is used
+	// as is, the generic one gets the traces path appended
+	config.TraceFile = os.Getenv("GOCODE_TRACE_FILE")
+	config.OTLPEndpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); config.OTLPEndpoint == "" && endpoint != "" {
+		config.OTLPEndpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	config.OTLPHeaders = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS")
+	if config.OTLPHeaders == "" {
+		config.OTLPHeaders = os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")
 	}
 	return config
 }
 
+// ModelChain returns the primary deployment followed by the fallback
+// deployments, in the order they should be tried
+func (c *AzureOpenAIConfig) ModelChain() []string {
+	primary := c.DeploymentName
+	if primary == "" {
+		primary = DefaultModel
+	}
+
+	chain := []string{primary}
+	seen := map[string]bool{primary: true}
+	for _, model := range c.FallbackDeployments {
+		if !seen[model] {
+			seen[model] = true
+			chain = append(chain, model)
+		}
+	}
+	return chain
+}
+
+// splitList parses a comma separated list, ignoring empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func GetOpenAIClient() *openai.Client {
 	config := LoadEnvConfig()
 
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ConfigDir returns the user-global go-code configuration directory,
+// $GOCODE_CONFIG_DIR when set, otherwise <user config dir>/go-code
+func ConfigDir() (string, error) {
+	if dir := os.Getenv("GOCODE_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, "go-code"), nil
+}
+
+// StateDir returns the per-user directory for go-code state such as history,
+// $GOCODE_STATE_DIR when set, otherwise $XDG_STATE_HOME/go-code or
+// ~/.local/state/go-code
+func StateDir() (string, error) {
+	if dir := os.Getenv("GOCODE_STATE_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "go-code"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "go-code"), nil
+}
+
+// LogDir returns the directory of the session log files, $GOCODE_LOG_DIR when
+// set, otherwise <state dir>/logs
+func LogDir() (string, error) {
+	if dir := os.Getenv("GOCODE_LOG_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logs"), nil
+}
+
+// TraceDir returns the directory of the local trace files, <state dir>/traces
+func TraceDir() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "traces"), nil
+}
+
+// CheckpointDir returns the directory of the file checkpoints,
+// <state dir>/checkpoints
+func CheckpointDir() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "checkpoints"), nil
+}
+
+// WorktreeDir returns the directory of the git worktrees created with
+// --worktree, <state dir>/worktrees
+func WorktreeDir() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "worktrees"), nil
+}
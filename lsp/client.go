@@ -0,0 +1,475 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// requestTimeout bounds a request; the first one may wait for the server
+	// to load the whole workspace
+	requestTimeout = 60 * time.Second
+	// shutdownTimeout bounds the polite shutdown before the server is killed
+	shutdownTimeout = 3 * time.Second
+)
+
+// message is a JSON-RPC 2.0 request, notification or response
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// document is the content of a file as last sent to the server
+type document struct {
+	version int
+	content string
+}
+
+// Client talks to one language server process over stdio
+type Client struct {
+	name       string
+	languageID string
+	root       string
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	// utf8 is set when the server counts characters in bytes rather than
+	// UTF-16 code units
+	utf8      bool
+	documents map[string]*document
+	// diagnostics are the last published for each URI, and published is
+	// closed and replaced whenever new ones arrive
+	diagnostics map[string][]Diagnostic
+	received    map[string]time.Time
+	published   chan struct{}
+
+	done   chan struct{}
+	err    error
+	stderr *tailBuffer
+}
+
+// startClient runs the server command in root and initializes it
+func startClient(name string, server ServerConfig, root string) (*Client, error) {
+	cmd := exec.Command(server.Command[0], server.Command[1:]...)
+	cmd.Dir = root
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		name:        name,
+		languageID:  server.LanguageID,
+		root:        root,
+		cmd:         cmd,
+		stdin:       stdin,
+		pending:     map[int64]chan *message{},
+		documents:   map[string]*document{},
+		diagnostics: map[string][]Diagnostic{},
+		received:    map[string]time.Time{},
+		published:   make(chan struct{}),
+		done:        make(chan struct{}),
+		stderr:      &tailBuffer{limit: 4096},
+	}
+	cmd.Stderr = c.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", server.Command[0], err)
+	}
+	go c.readLoop(bufio.NewReader(stdout))
+
+	if err := c.initialize(); err != nil {
+		c.kill()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) initialize() error {
+	rootURI := PathToURI(c.root)
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"clientInfo": map[string]interface{}{
+			"name": "go-code",
+		},
+		"rootUri": rootURI,
+		"workspaceFolders": []interface{}{
+			map[string]interface{}{"uri": rootURI, "name": filepath.Base(c.root)},
+		},
+		"capabilities": map[string]interface{}{
+			"general": map[string]interface{}{
+				"positionEncodings": []string{"utf-8", "utf-16"},
+			},
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]interface{}{"didSave": true},
+				"hover":              map[string]interface{}{"contentFormat": []string{"plaintext", "markdown"}},
+				"definition":         map[string]interface{}{"linkSupport": true},
+				"documentSymbol":     map[string]interface{}{"hierarchicalDocumentSymbolSupport": true},
+				"publishDiagnostics": map[string]interface{}{"versionSupport": true},
+				"rename":             map[string]interface{}{"prepareSupport": false},
+			},
+			"workspace": map[string]interface{}{
+				"workspaceEdit":    map[string]interface{}{"documentChanges": true},
+				"configuration":    true,
+				"workspaceFolders": true,
+			},
+		},
+	}
+
+	var result struct {
+		Capabilities struct {
+			PositionEncoding string `json:"positionEncoding"`
+		} `json:"capabilities"`
+	}
+	if err := c.call("initialize", params, &result); err != nil {
+		return fmt.Errorf("failed to initialize %s: %v", c.name, err)
+	}
+	c.utf8 = result.Capabilities.PositionEncoding == "utf-8"
+	return c.notify("initialized", map[string]interface{}{})
+}
+
+// call sends a request and decodes its result into result, when not nil
+func (c *Client) call(method string, params interface{}, result interface{}) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	reply := make(chan *message, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	rawID := json.RawMessage(strconv.FormatInt(id, 10))
+	if err := c.write(message{ID: &rawID, Method: method, Params: marshalParams(params)}); err != nil {
+		c.forget(id)
+		return err
+	}
+
+	select {
+	case response := <-reply:
+		if response.Error != nil {
+			return fmt.Errorf("%s: %s", method, response.Error.Message)
+		}
+		if result == nil || len(response.Result) == 0 {
+			return nil
+		}
+		return json.Unmarshal(response.Result, result)
+	case <-c.done:
+		return c.exitError()
+	case <-time.After(requestTimeout):
+		c.forget(id)
+		return fmt.Errorf("%s: %s did not answer within %v", method, c.name, requestTimeout)
+	}
+}
+
+func (c *Client) forget(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// notify sends a notification, which gets no response
+func (c *Client) notify(method string, params interface{}) error {
+	return c.write(message{Method: method, Params: marshalParams(params)})
+}
+
+func marshalParams(params interface{}) json.RawMessage {
+	if params == nil {
+		return nil
+	}
+	data, _ := json.Marshal(params)
+	return data
+}
+
+func (c *Client) write(msg message) error {
+	msg.JSONRPC = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return c.exitError()
+	}
+	if _, err := c.stdin.Write(body); err != nil {
+		return c.exitError()
+	}
+	return nil
+}
+
+// readLoop dispatches the messages of the server until it exits
+func (c *Client) readLoop(reader *bufio.Reader) {
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			c.mu.Lock()
+			c.err = err
+			c.mu.Unlock()
+			close(c.done)
+			c.cmd.Wait()
+			return
+		}
+
+		switch {
+		case msg.ID != nil && msg.Method == "":
+			id, err := strconv.ParseInt(string(*msg.ID), 10, 64)
+			if err != nil {
+				continue
+			}
+			c.mu.Lock()
+			reply := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if reply != nil {
+				reply <- msg
+			}
+		case msg.ID != nil:
+			c.answerServerRequest(msg)
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params publishDiagnosticsParams
+			if json.Unmarshal(msg.Params, &params) == nil {
+				c.mu.Lock()
+				c.diagnostics[params.URI] = params.Diagnostics
+				c.received[params.URI] = time.Now()
+				close(c.published)
+				c.published = make(chan struct{})
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+// answerServerRequest replies to the requests servers send to their client,
+// with the answer of a client that supports none of them
+func (c *Client) answerServerRequest(msg *message) {
+	var result interface{}
+	switch msg.Method {
+	case "workspace/configuration":
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		result = make([]interface{}, len(params.Items))
+	case "workspace/applyEdit":
+		result = map[string]interface{}{"applied": false}
+	}
+	raw, _ := json.Marshal(result)
+	c.write(message{ID: msg.ID, Result: raw})
+}
+
+func readMessage(reader *bufio.Reader) (*message, error) {
+	length := -1
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if value, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// exitError explains why the server stopped, with the end of its stderr
+func (c *Client) exitError() error {
+	select {
+	case <-c.done:
+	default:
+		return fmt.Errorf("failed to write to %s", c.name)
+	}
+	message := fmt.Sprintf("%s exited", c.name)
+	if output := strings.TrimSpace(c.stderr.String()); output != "" {
+		message += ": " + output
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// running reports whether the server process is still alive
+func (c *Client) running() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// syncFile sends the content of path to the server when it changed since it
+// was last sent, and returns the content and whether it was sent
+func (c *Client) syncFile(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	content := string(data)
+	uri := PathToURI(path)
+
+	c.mu.Lock()
+	doc := c.documents[uri]
+	if doc != nil && doc.content == content {
+		c.mu.Unlock()
+		return content, false, nil
+	}
+	if doc == nil {
+		doc = &document{}
+		c.documents[uri] = doc
+	}
+	doc.version++
+	doc.content = content
+	version := doc.version
+	c.mu.Unlock()
+
+	if version == 1 {
+		err = c.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"uri":        uri,
+				"languageId": c.languageID,
+				"version":    version,
+				"text":       content,
+			},
+		})
+	} else {
+		err = c.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []interface{}{map[string]interface{}{"text": content}},
+		})
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return content, true, c.notify("textDocument/didSave", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri},
+	})
+}
+
+// waitDiagnostics waits for diagnostics of uri published after since, for at
+// most timeout, and returns the latest ones
+func (c *Client) waitDiagnostics(uri string, since time.Time, timeout time.Duration) []Diagnostic {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		fresh := c.received[uri].After(since)
+		diagnostics := c.diagnostics[uri]
+		published := c.published
+		c.mu.Unlock()
+		if fresh {
+			return diagnostics
+		}
+
+		select {
+		case <-published:
+		case <-deadline:
+			return diagnostics
+		case <-c.done:
+			return diagnostics
+		}
+	}
+}
+
+// allDiagnostics returns the last diagnostics published for every file
+func (c *Client) allDiagnostics() map[string][]Diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	all := make(map[string][]Diagnostic, len(c.diagnostics))
+	for uri, diagnostics := range c.diagnostics {
+		if len(diagnostics) > 0 {
+			all[uri] = diagnostics
+		}
+	}
+	return all
+}
+
+// shutdown asks the server to exit, and kills it if it doesn't
+func (c *Client) shutdown() {
+	if c.running() {
+		done := make(chan struct{})
+		go func() {
+			c.call("shutdown", nil, nil)
+			c.notify("exit", nil)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(shutdownTimeout):
+		}
+	}
+	c.stdin.Close()
+	select {
+	case <-c.done:
+	case <-time.After(shutdownTimeout):
+		c.kill()
+	}
+}
+
+func (c *Client) kill() {
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+}
+
+// tailBuffer keeps the last bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	data  []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data = append(b.data, p...)
+	if len(b.data) > b.limit {
+		b.data = b.data[len(b.data)-b.limit:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.data)
+}
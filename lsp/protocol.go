@@ -0,0 +1,126 @@
+package lsp
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+)
+
+// The subset of the Language Server Protocol used by go-code, see
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+// Position is a zero-based line and character offset. Characters are counted
+// in the encoding negotiated with the server, UTF-16 unless it accepts UTF-8.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// locationLink is returned instead of Location by servers supporting links
+type locationLink struct {
+	TargetURI            string `json:"targetUri"`
+	TargetSelectionRange Range  `json:"targetSelectionRange"`
+}
+
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+type textDocumentEdit struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Edits []TextEdit `json:"edits"`
+	// Kind is set for file operations (create, rename, delete)
+	Kind string `json:"kind"`
+}
+
+type workspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes"`
+	DocumentChanges []textDocumentEdit    `json:"documentChanges"`
+}
+
+// Diagnostic severities
+const (
+	SeverityError       = 1
+	SeverityWarning     = 2
+	SeverityInformation = 3
+	SeverityHint        = 4
+)
+
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// documentSymbol is the hierarchical symbol of textDocument/documentSymbol
+type documentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail"`
+	Kind           int              `json:"kind"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []documentSymbol `json:"children"`
+}
+
+// symbolInformation is the flat symbol of workspace/symbol and of older
+// textDocument/documentSymbol implementations
+type symbolInformation struct {
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName"`
+}
+
+type hover struct {
+	Contents json.RawMessage `json:"contents"`
+}
+
+// symbolKinds names the SymbolKind values, which start at 1
+var symbolKinds = []string{"", "file", "module", "namespace", "package", "class", "method", "property",
+	"field", "constructor", "enum", "interface", "function", "variable", "constant", "string", "number",
+	"boolean", "array", "object", "key", "null", "enum member", "struct", "event", "operator", "type parameter"}
+
+func symbolKindName(kind int) string {
+	if kind > 0 && kind < len(symbolKinds) {
+		return symbolKinds[kind]
+	}
+	return "symbol"
+}
+
+// PathToURI returns the file URI of path
+func PathToURI(path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		absolute = path
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absolute)}).String()
+}
+
+// URIToPath returns the path of a file URI
+func URIToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
@@ -0,0 +1,295 @@
+// Package lsp runs locally installed language servers, gopls by default, and
+// answers code intelligence queries about the working directory
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/KacemMathlouthi/go-code/config"
+)
+
+// ServerConfig is how to run the language server of one language
+type ServerConfig struct {
+	// Command is the server executable and its arguments, an empty command
+	// disables the language
+	Command    []string `json:"command"`
+	Extensions []string `json:"extensions"`
+	LanguageID string   `json:"languageId"`
+	// RootMarkers are the files marking the workspace root of a file, the
+	// nearest directory holding one is used, then the repository root
+	RootMarkers []string `json:"rootMarkers"`
+}
+
+// defaultServers are used unless overridden in lsp.json
+var defaultServers = map[string]ServerConfig{
+	"go": {Command: []string{"gopls"}, Extensions: []string{".go"}, LanguageID: "go", RootMarkers: []string{"go.mod"}},
+}
+
+// vcsMarkers mark the root of a repository, used when no root marker of the
+// language is found
+var vcsMarkers = []string{".git", ".hg", ".svn"}
+
+// startedServer is a server started, or being started, for a language and a
+// workspace root
+type startedServer struct {
+	// ready is closed once the server is initialized or failed to start
+	ready  chan struct{}
+	client *Client
+	err    error
+}
+
+var (
+	mu      sync.Mutex
+	loaded  bool
+	servers map[string]ServerConfig
+	loadErr error
+	clients = map[string]*startedServer{}
+)
+
+// ConfigPath returns the file overriding the language servers,
+// <config dir>/lsp.json
+func ConfigPath() (string, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "lsp.json"), nil
+}
+
+// loadServers merges lsp.json into the default servers and drops those whose
+// command is not installed. Callers hold mu.
+func loadServers() {
+	if loaded {
+		return
+	}
+	loaded = true
+
+	configured := map[string]ServerConfig{}
+	for language, server := range defaultServers {
+		configured[language] = server
+	}
+	if path, err := ConfigPath(); err == nil {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var overrides map[string]ServerConfig
+			if err := json.Unmarshal(data, &overrides); err != nil {
+				loadErr = fmt.Errorf("invalid %s: %v", path, err)
+			}
+			for language, server := range overrides {
+				if server.LanguageID == "" {
+					server.LanguageID = language
+				}
+				if len(server.RootMarkers) == 0 {
+					server.RootMarkers = defaultServers[language].RootMarkers
+				}
+				configured[language] = server
+			}
+		}
+	}
+
+	servers = map[string]ServerConfig{}
+	for language, server := range configured {
+		if len(server.Command) == 0 || len(server.Extensions) == 0 {
+			continue
+		}
+		if _, err := exec.LookPath(server.Command[0]); err != nil {
+			continue
+		}
+		servers[language] = server
+	}
+}
+
+// Available reports whether a language server is installed for at least one
+// language, the LSP tools are only offered then
+func Available() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	loadServers()
+	return len(servers) > 0
+}
+
+// Languages returns the languages with an installed server, sorted
+func Languages() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	loadServers()
+	var languages []string
+	for language := range servers {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Handles reports whether a language server is installed for the language of
+// path
+func Handles(path string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	loadServers()
+	_, ok := languageOf(path)
+	return ok && loadErr == nil
+}
+
+// languageOf returns the language of path from its extension
+func languageOf(path string) (string, bool) {
+	extension := strings.ToLower(filepath.Ext(path))
+	for language, server := range servers {
+		for _, candidate := range server.Extensions {
+			if strings.ToLower(candidate) == extension {
+				return language, true
+			}
+		}
+	}
+	return "", false
+}
+
+// clientFor returns the running client of the language of path for its
+// workspace root, starting the server on first use
+func clientFor(path string) (*Client, error) {
+	mu.Lock()
+	loadServers()
+	if loadErr != nil {
+		mu.Unlock()
+		return nil, loadErr
+	}
+	language, ok := languageOf(path)
+	server := servers[language]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no language server is configured for %s files", filepath.Ext(path))
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return startLanguage(language, workspaceRoot(filepath.Dir(absolute), server.RootMarkers))
+}
+
+// anyClient returns a client for queries without a file, preferring Go, in
+// the workspace of the working directory
+func anyClient() (*Client, error) {
+	mu.Lock()
+	loadServers()
+	if loadErr != nil {
+		mu.Unlock()
+		return nil, loadErr
+	}
+	language := ""
+	if _, ok := servers["go"]; ok {
+		language = "go"
+	} else {
+		for candidate := range servers {
+			language = candidate
+			break
+		}
+	}
+	server := servers[language]
+	mu.Unlock()
+	if language == "" {
+		return nil, fmt.Errorf("no language server is installed")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return startLanguage(language, workspaceRoot(cwd, server.RootMarkers))
+}
+
+// workspaceRoot returns the nearest directory above dir holding one of
+// markers, else the repository root, else dir
+func workspaceRoot(dir string, markers []string) string {
+	for _, candidates := range [][]string{markers, vcsMarkers} {
+		for current := dir; ; {
+			for _, marker := range candidates {
+				if _, err := os.Stat(filepath.Join(current, marker)); err == nil {
+					return current
+				}
+			}
+			parent := filepath.Dir(current)
+			if parent == current {
+				break
+			}
+			current = parent
+		}
+	}
+	return dir
+}
+
+// startLanguage returns the client of language for root, restarting a server
+// that exited or failed to start. The server is initialized without holding
+// mu, so queries to the other servers go on meanwhile, and concurrent callers
+// wait for the same start.
+func startLanguage(language, root string) (*Client, error) {
+	key := language + " " + root
+	mu.Lock()
+	started := clients[key]
+	if started != nil {
+		select {
+		case <-started.ready:
+			if started.err != nil || !started.client.running() {
+				started = nil
+			}
+		default:
+		}
+	}
+	if started != nil {
+		mu.Unlock()
+		<-started.ready
+		return started.client, started.err
+	}
+	started = &startedServer{ready: make(chan struct{})}
+	clients[key] = started
+	server := servers[language]
+	mu.Unlock()
+
+	started.client, started.err = startClient(language+" language server", server, root)
+	close(started.ready)
+	return started.client, started.err
+}
+
+// runningClients returns the servers started so far
+func runningClients() []*Client {
+	mu.Lock()
+	defer mu.Unlock()
+	var running []*Client
+	for _, started := range clients {
+		select {
+		case <-started.ready:
+			if started.err == nil && started.client.running() {
+				running = append(running, started.client)
+			}
+		default:
+		}
+	}
+	return running
+}
+
+// Shutdown stops the running language servers
+func Shutdown() {
+	mu.Lock()
+	started := clients
+	clients = map[string]*startedServer{}
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, server := range started {
+		wg.Add(1)
+		go func(server *startedServer) {
+			defer wg.Done()
+			// A server still starting is stopped once initialized
+			<-server.ready
+			if server.err == nil {
+				server.client.shutdown()
+			}
+		}(server)
+	}
+	wg.Wait()
+}
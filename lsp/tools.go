@@ -0,0 +1,706 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	maxReferences       = 100
+	maxWorkspaceSymbols = 50
+	maxDiagnostics      = 100
+	// diagnosticsWait is how long to wait for the server to analyze a change
+	diagnosticsWait = 5 * time.Second
+)
+
+// target is a position in a file, resolved for the server
+type target struct {
+	client   *Client
+	uri      string
+	position Position
+	// name is the identifier at the position
+	name string
+}
+
+// resolve turns a 1-based line and either a symbol on that line or a 1-based
+// column into a server position
+func resolve(path, line, symbol, column string) (*target, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	lineNumber, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || lineNumber <= 0 {
+		return nil, fmt.Errorf("invalid line %q, expected a positive number", line)
+	}
+	client, err := clientFor(path)
+	if err != nil {
+		return nil, err
+	}
+	content, _, err := client.syncFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(content, "\n")
+	if lineNumber > len(lines) {
+		return nil, fmt.Errorf("%s has only %d lines", path, len(lines))
+	}
+	text := strings.TrimRight(lines[lineNumber-1], "\r")
+
+	var offset int
+	switch {
+	case symbol != "":
+		offset = identifierOffset(text, symbol)
+		if offset < 0 {
+			return nil, fmt.Errorf("%q not found on line %d of %s: %s", symbol, lineNumber, path, strings.TrimSpace(text))
+		}
+	case column != "":
+		n, err := strconv.Atoi(strings.TrimSpace(column))
+		if err != nil || n <= 0 || n > utf8.RuneCountInString(text)+1 {
+			return nil, fmt.Errorf("invalid column %q for line %d of %s", column, lineNumber, path)
+		}
+		offset = len(string([]rune(text)[:n-1]))
+	default:
+		return nil, fmt.Errorf("symbol or column is required")
+	}
+
+	return &target{
+		client:   client,
+		uri:      PathToURI(path),
+		position: Position{Line: lineNumber - 1, Character: client.character(text, offset)},
+		name:     identifierAt(text, offset),
+	}, nil
+}
+
+// identifierOffset returns the byte offset of the first occurrence of name in
+// text that is a whole identifier, or of any occurrence otherwise
+func identifierOffset(text, name string) int {
+	first := -1
+	for start := 0; start <= len(text); {
+		i := strings.Index(text[start:], name)
+		if i < 0 {
+			break
+		}
+		i += start
+		if first < 0 {
+			first = i
+		}
+		before, _ := utf8.DecodeLastRuneInString(text[:i])
+		after, _ := utf8.DecodeRuneInString(text[i+len(name):])
+		if !isIdentifierRune(before) && !isIdentifierRune(after) {
+			return i
+		}
+		start = i + 1
+	}
+	return first
+}
+
+func identifierAt(text string, offset int) string {
+	start, end := offset, offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !isIdentifierRune(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !isIdentifierRune(r) {
+			break
+		}
+		end += size
+	}
+	return text[start:end]
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// character converts a byte offset in a line to the server encoding
+func (c *Client) character(line string, offset int) int {
+	if c.utf8 {
+		return offset
+	}
+	return len(utf16.Encode([]rune(line[:offset])))
+}
+
+// byteOffset converts a server character offset in a line to bytes
+func (c *Client) byteOffset(line string, character int) int {
+	if c.utf8 {
+		return min(character, len(line))
+	}
+	units := 0
+	for i, r := range line {
+		if units >= character {
+			return i
+		}
+		units += utf16.RuneLen(r)
+	}
+	return len(line)
+}
+
+// fileLines caches the lines of the files locations are shown from
+type fileLines map[string][]string
+
+func (f fileLines) get(path string) []string {
+	lines, ok := f[path]
+	if !ok {
+		if data, err := os.ReadFile(path); err == nil {
+			lines = strings.Split(string(data), "\n")
+		}
+		f[path] = lines
+	}
+	return lines
+}
+
+// format shows a location as path:line:column followed by its source line
+func (c *Client) format(location Location, lines fileLines) string {
+	position, text := c.locate(location, lines)
+	if text != "" {
+		return position + ": " + text
+	}
+	return position
+}
+
+// locate returns a location as path:line:column, with a 1-based column in
+// characters, and its trimmed source line
+func (c *Client) locate(location Location, lines fileLines) (string, string) {
+	path := URIToPath(location.URI)
+	line := location.Range.Start.Line
+	column := location.Range.Start.Character + 1
+	text := ""
+	if fileText := lines.get(path); line < len(fileText) {
+		text = strings.TrimRight(fileText[line], "\r")
+		column = utf8.RuneCountInString(text[:c.byteOffset(text, location.Range.Start.Character)]) + 1
+		text = strings.TrimSpace(text)
+	}
+	return fmt.Sprintf("%s:%d:%d", DisplayPath(path), line+1, column), text
+}
+
+// DisplayPath shortens paths inside the working directory
+func DisplayPath(path string) string {
+	if cwd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// params returns the TextDocumentPositionParams of the target
+func (t *target) params() map[string]interface{} {
+	return map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": t.uri},
+		"position":     t.position,
+	}
+}
+
+// parseLocations decodes a Location, a Location array or a LocationLink array
+func parseLocations(raw json.RawMessage) []Location {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	var single Location
+	if raw[0] == '{' {
+		if json.Unmarshal(raw, &single) == nil {
+			return []Location{single}
+		}
+		return nil
+	}
+
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) != nil {
+		return nil
+	}
+	var locations []Location
+	for _, item := range items {
+		var link locationLink
+		if json.Unmarshal(item, &link) == nil && link.TargetURI != "" {
+			locations = append(locations, Location{URI: link.TargetURI, Range: link.TargetSelectionRange})
+			continue
+		}
+		var location Location
+		if json.Unmarshal(item, &location) == nil && location.URI != "" {
+			locations = append(locations, location)
+		}
+	}
+	return locations
+}
+
+// Definition returns where the symbol at the position is declared
+func Definition(path, line, symbol, column string) (string, error) {
+	t, err := resolve(path, line, symbol, column)
+	if err != nil {
+		return "", err
+	}
+	var raw json.RawMessage
+	if err := t.client.call("textDocument/definition", t.params(), &raw); err != nil {
+		return "", err
+	}
+	locations := parseLocations(raw)
+	if len(locations) == 0 {
+		return fmt.Sprintf("no definition found for %q", t.name), nil
+	}
+
+	lines := fileLines{}
+	var result []string
+	for _, location := range locations {
+		result = append(result, t.client.format(location, lines))
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+// References lists the uses of the symbol at the position, its declaration
+// included
+func References(path, line, symbol, column string) (string, error) {
+	t, err := resolve(path, line, symbol, column)
+	if err != nil {
+		return "", err
+	}
+	params := t.params()
+	params["context"] = map[string]interface{}{"includeDeclaration": true}
+	var raw json.RawMessage
+	if err := t.client.call("textDocument/references", params, &raw); err != nil {
+		return "", err
+	}
+	locations := parseLocations(raw)
+	if len(locations) == 0 {
+		return fmt.Sprintf("no references found for %q", t.name), nil
+	}
+	sortLocations(locations)
+
+	lines := fileLines{}
+	result := []string{fmt.Sprintf("%d reference(s) to %q:", len(locations), t.name)}
+	for i, location := range locations {
+		if i == maxReferences {
+			result = append(result, fmt.Sprintf("... %d more", len(locations)-maxReferences))
+			break
+		}
+		result = append(result, t.client.format(location, lines))
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+func sortLocations(locations []Location) {
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if a.URI != b.URI {
+			return a.URI < b.URI
+		}
+		if a.Range.Start.Line != b.Range.Start.Line {
+			return a.Range.Start.Line < b.Range.Start.Line
+		}
+		return a.Range.Start.Character < b.Range.Start.Character
+	})
+}
+
+// Hover returns the type, signature and documentation of the symbol at the
+// position
+func Hover(path, line, symbol, column string) (string, error) {
+	t, err := resolve(path, line, symbol, column)
+	if err != nil {
+		return "", err
+	}
+	var result *hover
+	if err := t.client.call("textDocument/hover", t.params(), &result); err != nil {
+		return "", err
+	}
+	if result == nil {
+		return fmt.Sprintf("no information for %q", t.name), nil
+	}
+	text := strings.TrimSpace(hoverText(result.Contents))
+	if text == "" {
+		return fmt.Sprintf("no information for %q", t.name), nil
+	}
+	return text, nil
+}
+
+// hoverText flattens MarkupContent, MarkedString and MarkedString arrays
+func hoverText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var markup struct {
+		Language string `json:"language"`
+		Value    string `json:"value"`
+	}
+	if json.Unmarshal(raw, &markup) == nil && markup.Value != "" {
+		if markup.Language != "" {
+			return "```" + markup.Language + "\n" + markup.Value + "\n```"
+		}
+		return markup.Value
+	}
+	var parts []json.RawMessage
+	if json.Unmarshal(raw, &parts) == nil {
+		var texts []string
+		for _, part := range parts {
+			texts = append(texts, hoverText(part))
+		}
+		return strings.Join(texts, "\n\n")
+	}
+	return ""
+}
+
+// DocumentSymbols outlines the declarations of a file
+func DocumentSymbols(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	client, err := clientFor(path)
+	if err != nil {
+		return "", err
+	}
+	if _, _, err := client.syncFile(path); err != nil {
+		return "", err
+	}
+	var raw []json.RawMessage
+	params := map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": PathToURI(path)},
+	}
+	if err := client.call("textDocument/documentSymbol", params, &raw); err != nil {
+		return "", err
+	}
+	if len(raw) == 0 {
+		return "no symbols in " + path, nil
+	}
+
+	var result []string
+	for _, item := range raw {
+		var symbol documentSymbol
+		if json.Unmarshal(item, &symbol) == nil && symbol.Range != (Range{}) {
+			result = appendSymbol(result, symbol, 0)
+			continue
+		}
+		var flat symbolInformation
+		if json.Unmarshal(item, &flat) == nil {
+			entry := fmt.Sprintf("%s %s (line %d)", symbolKindName(flat.Kind), flat.Name, flat.Location.Range.Start.Line+1)
+			if flat.ContainerName != "" {
+				entry = "  " + entry
+			}
+			result = append(result, entry)
+		}
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+func appendSymbol(result []string, symbol documentSymbol, depth int) []string {
+	entry := strings.Repeat("  ", depth) + symbolKindName(symbol.Kind) + " " + symbol.Name
+	if symbol.Detail != "" {
+		entry += " " + symbol.Detail
+	}
+	if symbol.Range.Start.Line == symbol.Range.End.Line {
+		entry += fmt.Sprintf(" (line %d)", symbol.Range.Start.Line+1)
+	} else {
+		entry += fmt.Sprintf(" (lines %d-%d)", symbol.Range.Start.Line+1, symbol.Range.End.Line+1)
+	}
+	result = append(result, entry)
+	for _, child := range symbol.Children {
+		result = appendSymbol(result, child, depth+1)
+	}
+	return result
+}
+
+// WorkspaceSymbols searches the declarations of the workspace by name
+func WorkspaceSymbols(query string) (string, error) {
+	if strings.TrimSpace(query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	client, err := anyClient()
+	if err != nil {
+		return "", err
+	}
+	var symbols []symbolInformation
+	if err := client.call("workspace/symbol", map[string]interface{}{"query": query}, &symbols); err != nil {
+		return "", err
+	}
+	if len(symbols) == 0 {
+		return fmt.Sprintf("no symbols matching %q", query), nil
+	}
+
+	lines := fileLines{}
+	var result []string
+	for i, symbol := range symbols {
+		if i == maxWorkspaceSymbols {
+			result = append(result, fmt.Sprintf("... %d more, refine the query", len(symbols)-maxWorkspaceSymbols))
+			break
+		}
+		name := symbol.Name
+		if symbol.ContainerName != "" && !strings.Contains(name, ".") {
+			name = symbol.ContainerName + "." + name
+		}
+		result = append(result, fmt.Sprintf("%s %s %s", symbolKindName(symbol.Kind), name, client.format(symbol.Location, lines)))
+	}
+	return strings.Join(result, "\n"), nil
+}
+
+// Rename renames the symbol at the position across the workspace and writes
+// the changed files. beforeChange, when not nil, is called with each file
+// before it is written; the rename stops when it fails.
+func Rename(path, line, symbol, column, newName string, beforeChange func(path string) error) (string, error) {
+	if strings.TrimSpace(newName) == "" {
+		return "", fmt.Errorf("new_name is required")
+	}
+	t, err := resolve(path, line, symbol, column)
+	if err != nil {
+		return "", err
+	}
+	params := t.params()
+	params["newName"] = newName
+	var edit *workspaceEdit
+	if err := t.client.call("textDocument/rename", params, &edit); err != nil {
+		return "", err
+	}
+	if edit == nil {
+		return fmt.Sprintf("%q can't be renamed here", t.name), nil
+	}
+
+	edits := map[string][]TextEdit{}
+	for uri, changes := range edit.Changes {
+		edits[uri] = append(edits[uri], changes...)
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.Kind != "" {
+			return "", fmt.Errorf("the rename needs a file %s, which is not supported", change.Kind)
+		}
+		edits[change.TextDocument.URI] = append(edits[change.TextDocument.URI], change.Edits...)
+	}
+	if len(edits) == 0 {
+		return fmt.Sprintf("nothing to rename for %q", t.name), nil
+	}
+
+	uris := make([]string, 0, len(edits))
+	for uri := range edits {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	// Compute every file first, so an invalid edit leaves all files untouched
+	type renamedFile struct {
+		path     string
+		original []byte
+		content  string
+		mode     os.FileMode
+		edits    int
+	}
+	var files []renamedFile
+	for _, uri := range uris {
+		file := URIToPath(uri)
+		original, content, mode, err := t.client.applyEdits(file, edits[uri])
+		if err != nil {
+			return "", fmt.Errorf("failed to edit %s, no file was changed: %v", file, err)
+		}
+		files = append(files, renamedFile{path: file, original: original, content: content, mode: mode, edits: len(edits[uri])})
+	}
+	if beforeChange != nil {
+		for _, file := range files {
+			if err := beforeChange(file.path); err != nil {
+				return "", fmt.Errorf("%s was not changed, no file was changed: %v", file.path, err)
+			}
+		}
+	}
+
+	// Write them all, restoring those already written if one fails
+	for i, file := range files {
+		if err := os.WriteFile(file.path, []byte(file.content), file.mode); err != nil {
+			for _, written := range files[:i] {
+				os.WriteFile(written.path, written.original, written.mode)
+				t.client.syncFile(written.path)
+			}
+			return "", fmt.Errorf("failed to write %s, the rename was rolled back: %v", file.path, err)
+		}
+	}
+
+	var summary []string
+	total := 0
+	for _, file := range files {
+		if _, _, err := t.client.syncFile(file.path); err != nil {
+			return "", err
+		}
+		total += file.edits
+		summary = append(summary, fmt.Sprintf("  %s (%d edit(s))", DisplayPath(file.path), file.edits))
+	}
+	return fmt.Sprintf("Renamed %q to %q: %d edit(s) in %d file(s)\n%s", t.name, newName, total, len(files), strings.Join(summary, "\n")), nil
+}
+
+// applyEdits returns the original content of path and its content with
+// edits, which must not overlap, applied, without writing it
+func (c *Client) applyEdits(path string, edits []TextEdit) ([]byte, string, os.FileMode, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	content := string(data)
+
+	// Line start offsets, to convert positions to byte offsets
+	starts := []int{0}
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	offset := func(position Position) int {
+		if position.Line >= len(starts) {
+			return len(content)
+		}
+		start := starts[position.Line]
+		end := len(content)
+		if position.Line+1 < len(starts) {
+			end = starts[position.Line+1] - 1
+		}
+		return start + c.byteOffset(content[start:end], position.Character)
+	}
+
+	// Apply from the end so earlier offsets stay valid
+	sorted := append([]TextEdit(nil), edits...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line > b.Line
+		}
+		return a.Character > b.Character
+	})
+	previous := len(content)
+	for _, edit := range sorted {
+		start, end := offset(edit.Range.Start), offset(edit.Range.End)
+		if start > end || end > previous {
+			return nil, "", 0, fmt.Errorf("invalid or overlapping edit range")
+		}
+		content = content[:start] + edit.NewText + content[end:]
+		previous = start
+	}
+	return data, content, info.Mode().Perm(), nil
+}
+
+// Diagnostics returns the errors and warnings of path once the server has
+// analyzed its current content. Without path it returns those of every file
+// the servers have reported on.
+func Diagnostics(path string) (string, error) {
+	if path == "" {
+		var result []string
+		for _, client := range runningClients() {
+			all := client.allDiagnostics()
+			uris := make([]string, 0, len(all))
+			for uri := range all {
+				uris = append(uris, uri)
+			}
+			sort.Strings(uris)
+			for _, uri := range uris {
+				result = append(result, client.formatDiagnostics(URIToPath(uri), all[uri])...)
+			}
+		}
+		if len(result) == 0 {
+			return "no diagnostics reported", nil
+		}
+		return truncateDiagnostics(result), nil
+	}
+
+	diagnostics, client, err := FileDiagnostics(path)
+	if err != nil {
+		return "", err
+	}
+	if len(diagnostics) == 0 {
+		return "no diagnostics for " + path, nil
+	}
+	return truncateDiagnostics(client.formatDiagnostics(path, diagnostics)), nil
+}
+
+// FileDiagnostics sends the current content of path to its server and waits
+// briefly for the diagnostics of that content
+func FileDiagnostics(path string) ([]Diagnostic, *Client, error) {
+	client, err := clientFor(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	since := time.Now()
+	_, sent, err := client.syncFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sent {
+		// Diagnostics already published for this content are current
+		since = time.Time{}
+	}
+	return client.waitDiagnostics(PathToURI(path), since, diagnosticsWait), client, nil
+}
+
+// FileErrors returns the errors the language server reports for the current
+// content of path, formatted as path:line:column: error: message
+func FileErrors(path string) ([]string, error) {
+	diagnostics, client, err := FileDiagnostics(path)
+	if err != nil {
+		return nil, err
+	}
+	var errors []Diagnostic
+	for _, diagnostic := range diagnostics {
+		if severityRank(diagnostic.Severity) == SeverityError {
+			errors = append(errors, diagnostic)
+		}
+	}
+	return client.formatDiagnostics(path, errors), nil
+}
+
+// formatDiagnostics shows diagnostics as path:line:column: severity: message,
+// errors first
+func (c *Client) formatDiagnostics(path string, diagnostics []Diagnostic) []string {
+	sorted := append([]Diagnostic(nil), diagnostics...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return severityRank(sorted[i].Severity) < severityRank(sorted[j].Severity)
+	})
+
+	lines := fileLines{}
+	var result []string
+	for _, diagnostic := range sorted {
+		location, _ := c.locate(Location{URI: PathToURI(path), Range: diagnostic.Range}, lines)
+		message := strings.ReplaceAll(strings.TrimSpace(diagnostic.Message), "\n", " ")
+		entry := fmt.Sprintf("%s: %s: %s", location, severityName(diagnostic.Severity), message)
+		if diagnostic.Source != "" {
+			entry += " (" + diagnostic.Source + ")"
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// severityRank orders errors first, a missing severity counts as an error
+func severityRank(severity int) int {
+	if severity == 0 {
+		return SeverityError
+	}
+	return severity
+}
+
+func severityName(severity int) string {
+	switch severity {
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "info"
+	case SeverityHint:
+		return "hint"
+	default:
+		return "error"
+	}
+}
+
+func truncateDiagnostics(result []string) string {
+	if len(result) > maxDiagnostics {
+		result = append(result[:maxDiagnostics], fmt.Sprintf("... %d more", len(result)-maxDiagnostics))
+	}
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,116 @@
+package lsp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIdentifierOffset(t *testing.T) {
+	tests := []struct {
+		text string
+		name string
+		want int
+	}{
+		{"func Run() {}", "Run", 5},
+		{"RunAll(); Run()", "Run", 10},
+		{"x := é_Run + Run", "Run", 14},
+		{"RunAll()", "Run", 0},
+		{"nothing here", "Run", -1},
+	}
+	for _, test := range tests {
+		if got := identifierOffset(test.text, test.name); got != test.want {
+			t.Errorf("identifierOffset(%q, %q) = %d, want %d", test.text, test.name, got, test.want)
+		}
+	}
+}
+
+func TestCharacterOffsets(t *testing.T) {
+	// "é" is 2 bytes and 1 UTF-16 unit, "😀" 4 bytes and 2 units
+	line := "aé😀b"
+	utf16Client, utf8Client := &Client{}, &Client{utf8: true}
+	tests := []struct {
+		offset, utf16 int
+	}{
+		{0, 0}, {1, 1}, {3, 2}, {7, 4}, {8, 5},
+	}
+	for _, test := range tests {
+		if got := utf16Client.character(line, test.offset); got != test.utf16 {
+			t.Errorf("character(%d) = %d, want %d UTF-16 units", test.offset, got, test.utf16)
+		}
+		if got := utf16Client.byteOffset(line, test.utf16); got != test.offset {
+			t.Errorf("byteOffset(%d) = %d, want %d bytes", test.utf16, got, test.offset)
+		}
+		if got := utf8Client.character(line, test.offset); got != test.offset {
+			t.Errorf("character(%d) with UTF-8 = %d, want it unchanged", test.offset, got)
+		}
+	}
+	if got := utf16Client.byteOffset(line, 100); got != len(line) {
+		t.Errorf("byteOffset() past the line end = %d, want %d", got, len(line))
+	}
+	if got := utf8Client.byteOffset(line, 100); got != len(line) {
+		t.Errorf("byteOffset() with UTF-8 past the line end = %d, want %d", got, len(line))
+	}
+}
+
+func TestParseLocations(t *testing.T) {
+	want := Location{URI: "file:///src/main.go", Range: Range{Start: Position{Line: 3, Character: 5}, End: Position{Line: 3, Character: 8}}}
+	location := `{"uri":"file:///src/main.go","range":{"start":{"line":3,"character":5},"end":{"line":3,"character":8}}}`
+	link := `{"originSelectionRange":{"start":{"line":0,"character":0},"end":{"line":0,"character":1}},
+		"targetUri":"file:///src/main.go",
+		"targetRange":{"start":{"line":2,"character":0},"end":{"line":6,"character":1}},
+		"targetSelectionRange":{"start":{"line":3,"character":5},"end":{"line":3,"character":8}}}`
+
+	tests := []struct {
+		name string
+		raw  string
+		want []Location
+	}{
+		{"null", "null", nil},
+		{"single location", location, []Location{want}},
+		{"location array", "[" + location + "," + location + "]", []Location{want, want}},
+		{"location links", "[" + link + "]", []Location{want}},
+		{"invalid", `"text"`, nil},
+	}
+	for _, test := range tests {
+		if got := parseLocations(json.RawMessage(test.raw)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseLocations(%s) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	original := "package main\n\nfunc old() {}\n\nvar s = \"é\" + old()\n"
+	if err := os.WriteFile(path, []byte(original), 0640); err != nil {
+		t.Fatal(err)
+	}
+	edit := func(line, start, end int, text string) TextEdit {
+		return TextEdit{Range: Range{Start: Position{line, start}, End: Position{line, end}}, NewText: text}
+	}
+	client := &Client{}
+
+	// Given in file order and in reverse, the result is the same
+	for _, edits := range [][]TextEdit{
+		{edit(2, 5, 8, "renamed"), edit(4, 14, 17, "renamed")},
+		{edit(4, 14, 17, "renamed"), edit(2, 5, 8, "renamed")},
+	} {
+		data, content, mode, err := client.applyEdits(path, edits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "package main\n\nfunc renamed() {}\n\nvar s = \"é\" + renamed()\n"
+		if string(data) != original || content != want || mode != 0640 {
+			t.Errorf("applyEdits() = %q, %q, %v, want the original, %q and the file mode", data, content, mode, want)
+		}
+	}
+
+	if _, _, _, err := client.applyEdits(path, []TextEdit{edit(2, 5, 8, "a"), edit(2, 6, 10, "b")}); err == nil {
+		t.Errorf("applyEdits() with overlapping edits succeeded")
+	}
+	if _, _, _, err := client.applyEdits(path, []TextEdit{edit(2, 8, 5, "a")}); err == nil {
+		t.Errorf("applyEdits() with an inverted range succeeded")
+	}
+}
@@ -0,0 +1,276 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultGitLogLimit is the number of commits listed when no limit is given
+	defaultGitLogLimit = 20
+	// maxGitLogLimit caps the commits listed in one call
+	maxGitLogLimit = 200
+)
+
+// RunGit runs git in the current directory without a pager, colors, prompts
+// or external diff tools, and returns its standard output
+func RunGit(args ...string) (string, error) {
+	return RunGitIn("", args...)
+}
+
+// RunGitIn runs git like RunGit, in dir
+func RunGitIn(dir string, args ...string) (string, error) {
+	return RunGitEnv(dir, nil, args...)
+}
+
+// RunGitEnv runs git like RunGitIn with extra environment variables, e.g.
+// GIT_INDEX_FILE
+func RunGitEnv(dir string, env []string, args ...string) (string, error) {
+	base := []string{"-c", "color.ui=never", "-c", "core.quotepath=off", "--no-pager"}
+	cmd := exec.Command("git", append(base, args...)...)
+	cmd.Dir = dir
+	// Never wait for credentials or an editor
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_EDITOR=true", "GIT_PAGER=cat")
+	cmd.Env = append(cmd.Env, env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = strings.TrimSpace(stdout.String())
+		}
+		if message == "" {
+			return "", fmt.Errorf("git %s: %v", args[0], err)
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], message)
+	}
+	return stdout.String(), nil
+}
+
+// parsePaths reads the paths argument, a JSON array of paths. Any other
+// non-empty value is a single path, which may contain spaces or commas.
+func parsePaths(paths string) ([]string, error) {
+	paths = strings.TrimSpace(paths)
+	if paths == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(paths, "[") {
+		return []string{paths}, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(paths), &list); err != nil {
+		return nil, fmt.Errorf("invalid paths %s, expected an array of strings", paths)
+	}
+	var files []string
+	for _, path := range list {
+		if strings.TrimSpace(path) != "" {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// GitStatus returns the branch and the staged, unstaged, untracked and
+// conflicted files of the repository
+func GitStatus() (string, error) {
+	out, err := RunGit("status", "--porcelain=v1", "--branch", "--untracked-files=all")
+	if err != nil {
+		return "", err
+	}
+
+	var branch string
+	sections := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimRight(out, "\n"), "\n") {
+		if strings.HasPrefix(line, "## ") {
+			branch = strings.TrimPrefix(line, "## ")
+			continue
+		}
+		if len(line) < 4 {
+			continue
+		}
+		x, y, path := line[0], line[1], line[3:]
+		switch {
+		case x == '?' && y == '?':
+			sections["untracked"] = append(sections["untracked"], path)
+		case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+			sections["conflicted"] = append(sections["conflicted"], path)
+		default:
+			if x != ' ' {
+				sections["staged"] = append(sections["staged"], statusName(x)+" "+path)
+			}
+			if y != ' ' {
+				sections["unstaged"] = append(sections["unstaged"], statusName(y)+" "+path)
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "branch: %s\n", branch)
+	empty := true
+	for _, section := range []string{"conflicted", "staged", "unstaged", "untracked"} {
+		files := sections[section]
+		if len(files) == 0 {
+			continue
+		}
+		empty = false
+		fmt.Fprintf(&b, "%s (%d):\n", section, len(files))
+		for _, file := range files {
+			fmt.Fprintf(&b, "  %s\n", file)
+		}
+	}
+	if empty {
+		b.WriteString("working tree clean\n")
+	}
+	return b.String(), nil
+}
+
+func statusName(code byte) string {
+	switch code {
+	case 'M':
+		return "modified:"
+	case 'A':
+		return "added:   "
+	case 'D':
+		return "deleted: "
+	case 'R':
+		return "renamed: "
+	case 'C':
+		return "copied:  "
+	case 'T':
+		return "type:    "
+	default:
+		return string(code) + ":       "
+	}
+}
+
+// GitDiff returns the unstaged changes, or the staged ones, of the given
+// paths or of the whole repository, headed by a summary of changed files
+func GitDiff(paths string, staged bool) (string, error) {
+	args := []string{"diff", "--no-ext-diff", "--no-color"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	files, err := parsePaths(paths)
+	if err != nil {
+		return "", err
+	}
+	args = append(append(args, "--"), files...)
+
+	stat, err := RunGit(append([]string{"diff", "--stat=120"}, args[1:]...)...)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(stat) == "" {
+		if staged {
+			return "no staged changes", nil
+		}
+		return "no unstaged changes", nil
+	}
+	patch, err := RunGit(args...)
+	if err != nil {
+		return "", err
+	}
+	return stat + "\n" + patch, nil
+}
+
+// GitLog lists recent commits as "<hash> <date> <author> <subject>", at most
+// limit of them, optionally only those touching path
+func GitLog(limit string, path string) (string, error) {
+	n := defaultGitLogLimit
+	if limit != "" {
+		parsed, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || parsed <= 0 {
+			return "", fmt.Errorf("invalid limit %q, expected a positive number", limit)
+		}
+		n = min(parsed, maxGitLogLimit)
+	}
+
+	args := []string{"log", "-n", strconv.Itoa(n), "--date=short", "--format=%h %ad %an%d %s"}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	out, err := RunGit(args...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "no commits", nil
+	}
+	return out, nil
+}
+
+// GitBlame shows who last changed each line of path, between startLine and
+// endLine when given
+func GitBlame(path, startLine, endLine string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	args := []string{"blame", "--date=short"}
+	if startLine != "" || endLine != "" {
+		start, end := strings.TrimSpace(startLine), strings.TrimSpace(endLine)
+		if start == "" {
+			start = "1"
+		}
+		for _, line := range []string{start, end} {
+			if n, err := strconv.Atoi(line); line != "" && (err != nil || n <= 0) {
+				return "", fmt.Errorf("invalid line number %q", line)
+			}
+		}
+		args = append(args, "-L", start+","+end)
+	}
+	out, err := RunGit(append(args, "--", path)...)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// GitShow returns the message, changed files and patch of a commit
+func GitShow(revision string) (string, error) {
+	if revision == "" {
+		revision = "HEAD"
+	}
+	if strings.HasPrefix(revision, "-") {
+		return "", fmt.Errorf("invalid revision %q", revision)
+	}
+	out, err := RunGit("show", "--no-ext-diff", "--stat=120", "--patch", "--date=iso",
+		"--format=commit %H%nAuthor: %an <%ae>%nDate:   %ad%n%n%B", revision, "--")
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// GitCommit stages paths, if any, and commits the staged changes with message
+func GitCommit(message, paths string) (string, error) {
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("a commit message is required")
+	}
+	files, err := parsePaths(paths)
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 0 {
+		if _, err := RunGit(append([]string{"add", "--"}, files...)...); err != nil {
+			return "", err
+		}
+	}
+	if _, err := RunGit("diff", "--cached", "--quiet"); err == nil {
+		return "", fmt.Errorf("nothing to commit, stage changes or pass paths")
+	}
+	if _, err := RunGit("commit", "-m", message); err != nil {
+		// Leave the index as it was, e.g. when a hook rejected the commit
+		if len(files) > 0 {
+			RunGit(append([]string{"reset", "-q", "--"}, files...)...)
+		}
+		return "", err
+	}
+	return RunGit("show", "--stat=120", "--format=committed %h %s", "HEAD")
+}
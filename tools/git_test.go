@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePaths(t *testing.T) {
+	tests := []struct {
+		paths   string
+		want    []string
+		wantErr bool
+	}{
+		{paths: "", want: nil},
+		{paths: "  ", want: nil},
+		{paths: "cmd/root.go", want: []string{"cmd/root.go"}},
+		{paths: "docs/release notes.md", want: []string{"docs/release notes.md"}},
+		{paths: `["cmd/root.go", "my file.go", ""]`, want: []string{"cmd/root.go", "my file.go"}},
+		{paths: `[]`, want: nil},
+		{paths: `["unterminated`, wantErr: true},
+		{paths: `[1, 2]`, wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parsePaths(test.paths)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parsePaths(%q) error = %v, want error %v", test.paths, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parsePaths(%q) = %q, want %q", test.paths, got, test.want)
+		}
+	}
+}
+
+func TestGitArgumentValidation(t *testing.T) {
+	if _, err := GitLog("zero", ""); err == nil {
+		t.Errorf("GitLog() with an invalid limit succeeded")
+	}
+	if _, err := GitBlame("", "", ""); err == nil {
+		t.Errorf("GitBlame() without a path succeeded")
+	}
+	if _, err := GitBlame("main.go", "-3", ""); err == nil {
+		t.Errorf("GitBlame() with a negative line succeeded")
+	}
+	if _, err := GitShow("--output=/tmp/x"); err == nil {
+		t.Errorf("GitShow() with an option as revision succeeded")
+	}
+	if _, err := GitCommit("  ", ""); err == nil {
+		t.Errorf("GitCommit() without a message succeeded")
+	}
+}
+
+// initRepository creates a repository with one commit in a temporary working
+// directory
+func initRepository(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Chdir(t.TempDir())
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+	for _, args := range [][]string{{"init", "-q"}, {"commit", "-q", "--allow-empty", "-m", "initial"}} {
+		if _, err := RunGit(args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitDiffAndCommitPathsWithSpaces(t *testing.T) {
+	initRepository(t)
+	for _, name := range []string{"release notes.md", "other.md"} {
+		if err := os.WriteFile(name, []byte("content\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := GitCommit("docs: add release notes", `["release notes.md"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "release notes.md") || strings.Contains(out, "other.md") {
+		t.Errorf("GitCommit() = %q, want only the given file committed", out)
+	}
+
+	if err := os.WriteFile("release notes.md", []byte("changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := GitDiff(`["release notes.md"]`, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff, "+changed") {
+		t.Errorf("GitDiff() = %q, want the change of the file", diff)
+	}
+	if diff, err := GitDiff("", true); err != nil || diff != "no staged changes" {
+		t.Errorf("GitDiff(staged) = %q, %v, want no staged changes", diff, err)
+	}
+	if _, err := GitCommit("nothing", ""); err == nil {
+		t.Errorf("GitCommit() with nothing staged succeeded")
+	}
+}
+
+func TestGitCommitFailureUnstagesPaths(t *testing.T) {
+	initRepository(t)
+	hook := "#!/bin/sh\nexit 1\n"
+	if err := os.WriteFile(".git/hooks/pre-commit", []byte(hook), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("main.go", []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GitCommit("feat: add main", `["main.go"]`); err == nil {
+		t.Fatal("GitCommit() with a rejecting hook succeeded")
+	}
+	if staged, err := RunGit("diff", "--cached", "--name-only"); err != nil || staged != "" {
+		t.Errorf("staged files after the failed commit = %q, %v, want none", staged, err)
+	}
+}
@@ -0,0 +1,225 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceName identifies go-code in exported traces
+const serviceName = "go-code"
+
+// otlpTimeout bounds an export request to the collector
+const otlpTimeout = 5 * time.Second
+
+// OTLPExporter posts spans as OTLP/HTTP JSON to a collector
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter sends spans to endpoint. An endpoint without a path gets
+// the standard /v1/traces path. Headers are "key=value" pairs separated by
+// commas, as in OTEL_EXPORTER_OTLP_HEADERS.
+func NewOTLPExporter(endpoint, headers string) (*OTLPExporter, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	if parsed.Path == "" || parsed.Path == "/" {
+		parsed.Path = "/v1/traces"
+	}
+
+	exporter := &OTLPExporter{
+		endpoint: parsed.String(),
+		headers:  map[string]string{},
+		client:   &http.Client{Timeout: otlpTimeout},
+	}
+	for _, pair := range strings.Split(headers, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if found && strings.TrimSpace(key) != "" {
+			decoded, err := url.QueryUnescape(strings.TrimSpace(value))
+			if err != nil {
+				decoded = strings.TrimSpace(value)
+			}
+			exporter.headers[strings.TrimSpace(key)] = decoded
+		}
+	}
+	return exporter, nil
+}
+
+func (e *OTLPExporter) Export(spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %v", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("failed to export spans: %s returned %s", e.endpoint, response.Status)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown() error {
+	return nil
+}
+
+// otlpRequest builds an ExportTraceServiceRequest in the OTLP JSON encoding
+func otlpRequest(spans []*Span) map[string]interface{} {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		status := map[string]interface{}{"code": 1}
+		if span.Failed {
+			status = map[string]interface{}{"code": 2, "message": span.Err}
+		}
+		entry := map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              int(span.Kind),
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+			"status":            status,
+		}
+		if span.ParentID != "" {
+			entry["parentSpanId"] = span.ParentID
+		}
+		encoded = append(encoded, entry)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": serviceName},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	encoded := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": value})
+	}
+	return encoded
+}
+
+// FileExporter appends spans to a file in the Chrome trace event format,
+// which can be opened offline in Perfetto (ui.perfetto.dev) or chrome://tracing
+type FileExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileExporter creates the trace file at path
+func NewFileExporter(path string) (*FileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace file: %v", err)
+	}
+	// The closing bracket is optional in the array format, so spans can be
+	// appended as they are exported
+	if _, err := file.WriteString("[\n"); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileExporter{file: file}, nil
+}
+
+func (e *FileExporter) Export(spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var b bytes.Buffer
+	for _, span := range spans {
+		args := map[string]interface{}{
+			"trace_id": span.TraceID,
+			"span_id":  span.SpanID,
+		}
+		if span.ParentID != "" {
+			args["parent_span_id"] = span.ParentID
+		}
+		for key, value := range span.Attributes {
+			args[key] = value
+		}
+		if span.Failed {
+			args["error"] = span.Err
+		}
+
+		event, err := json.Marshal(map[string]interface{}{
+			"name": span.Name,
+			"cat":  strings.SplitN(span.Name, ".", 2)[0],
+			"ph":   "X",
+			"ts":   span.Start.UnixMicro(),
+			"dur":  span.End.Sub(span.Start).Microseconds(),
+			"pid":  os.Getpid(),
+			"tid":  1,
+			"args": args,
+		})
+		if err != nil {
+			return err
+		}
+		b.Write(event)
+		b.WriteString(",\n")
+	}
+	_, err := e.file.Write(b.Bytes())
+	return err
+}
+
+func (e *FileExporter) Shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
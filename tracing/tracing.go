@@ -0,0 +1,200 @@
+// Package tracing records spans around turns, LLM calls and tool calls and
+// exports them to an OTLP/HTTP endpoint or to a local trace file
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/KacemMathlouthi/go-code/utils"
+)
+
+// SpanKind tells whether a span is local work or a call to a remote service
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindClient   SpanKind = 3
+)
+
+// Span is a timed operation with attributes
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	// Err is the error message of a failed operation
+	Err    string
+	Failed bool
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	Export(spans []*Span) error
+	Shutdown() error
+}
+
+// maxAttributeLength caps string attributes such as tool arguments
+const maxAttributeLength = 256
+
+type spanKey struct{}
+
+var (
+	mu        sync.Mutex
+	exporters []Exporter
+	pending   []*Span
+)
+
+// Enabled reports whether spans are recorded
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(exporters) > 0
+}
+
+// AddExporter enables tracing and sends the finished spans to exporter
+func AddExporter(exporter Exporter) {
+	mu.Lock()
+	defer mu.Unlock()
+	exporters = append(exporters, exporter)
+}
+
+// Start begins a span, child of the span in ctx if any. When tracing is
+// disabled it returns a nil span, whose methods do nothing.
+func Start(ctx context.Context, name string, kind SpanKind, attributes map[string]interface{}) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !Enabled() {
+		return ctx, nil
+	}
+
+	span := &Span{
+		SpanID:     newID(8),
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*Span); ok && parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+	for key, value := range attributes {
+		span.Attributes[key] = attributeValue(value)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttribute records an attribute on the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = attributeValue(value)
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Failed = true
+	s.Err = utils.Redact(err.Error())
+}
+
+// Finish ends the span and queues it for export
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	mu.Lock()
+	defer mu.Unlock()
+	pending = append(pending, s)
+}
+
+// Flush exports the finished spans. It returns the first export error.
+func Flush() error {
+	mu.Lock()
+	spans := pending
+	pending = nil
+	targets := append([]Exporter(nil), exporters...)
+	mu.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+	var firstErr error
+	for _, exporter := range targets {
+		if err := exporter.Export(spans); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Shutdown flushes the remaining spans and closes the exporters
+func Shutdown() error {
+	err := Flush()
+	mu.Lock()
+	targets := exporters
+	exporters = nil
+	mu.Unlock()
+
+	for _, exporter := range targets {
+		if shutdownErr := exporter.Shutdown(); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// attributeValue keeps numbers and booleans and turns anything else into a
+// redacted, truncated string
+func attributeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bool, int, int64, float64:
+		return v
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	}
+	text := utils.Redact(fmt.Sprint(value))
+	if runes := []rune(text); len(runes) > maxAttributeLength {
+		text = string(runes[:maxAttributeLength]) + "..."
+	}
+	return text
+}
+
+func newID(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
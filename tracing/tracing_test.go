@@ -0,0 +1,155 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordTurn records the spans of a turn: an iteration with an LLM call and a
+// failed tool call
+func recordTurn() (turn, iteration, llm, tool *Span) {
+	ctx, turn := Start(context.Background(), "agent.turn", KindInternal, map[string]interface{}{"input.length": 12})
+	iterationCtx, iteration := Start(ctx, "agent.iteration", KindInternal, nil)
+	_, llm = Start(iterationCtx, "llm.completion", KindClient, map[string]interface{}{"gen_ai.request.model": "gpt-test"})
+	llm.SetAttribute("gen_ai.usage.input_tokens", 10)
+	llm.Finish()
+	_, tool = Start(iterationCtx, "tool.shell", KindInternal, map[string]interface{}{"tool.command": "go test ./..."})
+	tool.SetError(errors.New("exit status 1"))
+	tool.Finish()
+	iteration.Finish()
+	turn.Finish()
+	return turn, iteration, llm, tool
+}
+
+func TestSpanTreeExport(t *testing.T) {
+	var otlpBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("OTLP request to %s with %q, want /v1/traces with the configured header", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		otlpBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	otlp, err := NewOTLPExporter(server.URL, "Authorization=Bearer%20token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracePath := filepath.Join(t.TempDir(), "trace.json")
+	file, err := NewFileExporter(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AddExporter(otlp)
+	AddExporter(file)
+
+	turn, iteration, llm, tool := recordTurn()
+	if err := Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	if Enabled() {
+		t.Errorf("Enabled() after Shutdown() = true, want false")
+	}
+
+	if turn.ParentID != "" || iteration.ParentID != turn.SpanID || llm.ParentID != iteration.SpanID || tool.ParentID != iteration.SpanID {
+		t.Errorf("parents = %q, %q, %q, %q, want turn → iteration → llm and tool", turn.ParentID, iteration.ParentID, llm.ParentID, tool.ParentID)
+	}
+	for _, span := range []*Span{iteration, llm, tool} {
+		if span.TraceID != turn.TraceID {
+			t.Errorf("span %s trace = %q, want the turn's %q", span.Name, span.TraceID, turn.TraceID)
+		}
+	}
+
+	var request struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Kind         int    `json:"kind"`
+					Attributes   []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+					Status struct {
+						Code    int    `json:"code"`
+						Message string `json:"message"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(otlpBody, &request); err != nil {
+		t.Fatalf("OTLP body %s: %v", otlpBody, err)
+	}
+	spans := request.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 4 {
+		t.Fatalf("OTLP spans = %d, want 4", len(spans))
+	}
+	byName := map[string]int{}
+	for i, span := range spans {
+		byName[span.Name] = i
+	}
+	exportedLLM, exportedTool := spans[byName["llm.completion"]], spans[byName["tool.shell"]]
+	if exportedLLM.ParentSpanID != iteration.SpanID || exportedLLM.Kind != int(KindClient) || exportedLLM.Status.Code != 1 {
+		t.Errorf("OTLP llm span = %+v, want a client child of the iteration with an ok status", exportedLLM)
+	}
+	if exportedLLM.Attributes[0].Key != "gen_ai.request.model" || exportedLLM.Attributes[1].Value["intValue"] != "10" {
+		t.Errorf("OTLP llm attributes = %+v, want sorted keys and string encoded integers", exportedLLM.Attributes)
+	}
+	if exportedTool.Status.Code != 2 || exportedTool.Status.Message != "exit status 1" {
+		t.Errorf("OTLP tool status = %+v, want an error with its message", exportedTool.Status)
+	}
+	if _, ok := byName["agent.turn"]; !ok || spans[byName["agent.turn"]].ParentSpanID != "" {
+		t.Errorf("OTLP turn span missing or not a root span")
+	}
+
+	data, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file is left open ended, close the array to decode it
+	var events []struct {
+		Name string                 `json:"name"`
+		Cat  string                 `json:"cat"`
+		Ph   string                 `json:"ph"`
+		Ts   int64                  `json:"ts"`
+		Dur  *int64                 `json:"dur"`
+		Args map[string]interface{} `json:"args"`
+	}
+	trimmed := strings.TrimSuffix(strings.TrimSpace(string(data)), ",") + "]"
+	if err := json.Unmarshal([]byte(trimmed), &events); err != nil {
+		t.Fatalf("trace file %s: %v", data, err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("trace events = %d, want 4", len(events))
+	}
+	for _, event := range events {
+		if event.Ph != "X" || event.Dur == nil || event.Ts == 0 || event.Cat != strings.SplitN(event.Name, ".", 2)[0] {
+			t.Errorf("trace event %+v, want a complete event with a category", event)
+		}
+		if event.Name == "tool.shell" && (event.Args["parent_span_id"] != iteration.SpanID || event.Args["error"] != "exit status 1") {
+			t.Errorf("tool event args = %v, want its parent and error", event.Args)
+		}
+	}
+}
+
+func TestStartWithoutExporters(t *testing.T) {
+	ctx, span := Start(context.Background(), "agent.turn", KindInternal, nil)
+	if span != nil || ctx == nil {
+		t.Fatalf("Start() without exporters = %v, want a nil span", span)
+	}
+	// The methods of a nil span do nothing
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("failed"))
+	span.Finish()
+}
@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// previewLines is how many lines of tool output are shown collapsed
+const previewLines = 3
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// ToolOutput is the output of a finished tool call, kept for /expand
+type ToolOutput struct {
+	Description string
+	Output      string
+}
+
+// ToolActivity renders tool calls live: a spinner with elapsed time while the
+// tool runs, then a success or failure line with a collapsed output preview
+type ToolActivity struct {
+	mu          sync.Mutex
+	interactive bool
+	description string
+	stop        chan struct{}
+	done        chan struct{}
+	outputs     []ToolOutput
+}
+
+// NewToolActivity creates a display writing to stdout. The spinner is only
+// animated when stdout is a terminal.
+func NewToolActivity() *ToolActivity {
+	return &ToolActivity{interactive: IsTerminal(os.Stdout)}
+}
+
+// SetAnimated turns the spinner on or off, e.g. when another view shows the
+// running tool
+func (a *ToolActivity) SetAnimated(animated bool) {
+	a.interactive = animated
+}
+
+// Reset forgets the outputs of the previous turn
+func (a *ToolActivity) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.outputs = nil
+}
+
+// Outputs returns the tool outputs recorded since the last Reset
+func (a *ToolActivity) Outputs() []ToolOutput {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]ToolOutput(nil), a.outputs...)
+}
+
+// Start shows a tool call as running
+func (a *ToolActivity) Start(toolName string, toolArgs map[string]string) {
+	a.mu.Lock()
+	a.description = DescribeToolCall(toolName, toolArgs)
+	a.mu.Unlock()
+
+	if !a.interactive {
+		fmt.Println(ColorDim + "… " + a.description + ColorReset)
+		return
+	}
+
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.spin(a.description, time.Now(), a.stop, a.done)
+}
+
+// Finish replaces the running line with the tool's outcome and output preview
+func (a *ToolActivity) Finish(result string, err error, duration time.Duration) {
+	if a.stop != nil {
+		close(a.stop)
+		<-a.done
+		a.stop = nil
+	}
+
+	a.mu.Lock()
+	description := a.description
+	output := result
+	if err != nil {
+		output = err.Error()
+	}
+	output = Redact(output)
+	a.outputs = append(a.outputs, ToolOutput{Description: description, Output: output})
+	index := len(a.outputs)
+	a.mu.Unlock()
+
+	elapsed := ColorDim + fmt.Sprintf("(%s)", duration.Round(time.Millisecond)) + ColorReset
+	if err != nil {
+		fmt.Println(ColorRed + "✗ " + ColorReset + description + " " + elapsed)
+	} else {
+		fmt.Println(ColorGreen + "✓ " + ColorReset + description + " " + elapsed)
+	}
+	fmt.Print(formatOutputPreview(output, index))
+}
+
+// spin animates the running line until stop is closed
+func (a *ToolActivity) spin(description string, start time.Time, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for frame := 0; ; frame++ {
+		elapsed := time.Since(start).Truncate(100 * time.Millisecond)
+		fmt.Printf("\r\033[K%s%s%s %s %s(%s)%s", ColorCyan, spinnerFrames[frame%len(spinnerFrames)], ColorReset, description, ColorDim, elapsed, ColorReset)
+		select {
+		case <-stop:
+			fmt.Print("\r\033[K")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// formatOutputPreview shows the first lines of a tool output, dimmed and indented
+func formatOutputPreview(output string, index int) string {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return ""
+	}
+
+	lines := strings.Split(output, "\n")
+	var b strings.Builder
+	for i, line := range lines {
+		if i == previewLines {
+			fmt.Fprintf(&b, "  %s… %d more lines (/expand %d to show)%s\n", ColorDim, len(lines)-previewLines, index, ColorReset)
+			break
+		}
+		if len([]rune(line)) > 120 {
+			line = string([]rune(line)[:119]) + "…"
+		}
+		b.WriteString("  " + ColorDim + line + ColorReset + "\n")
+	}
+	return b.String()
+}
+
+// DescribeToolCall turns a tool call into a short human readable action, with
+// the secrets in its arguments, such as a token in a shell command, masked
+func DescribeToolCall(toolName string, toolArgs map[string]string) string {
+	return Redact(describeToolCall(toolName, toolArgs))
+}
+
+func describeToolCall(toolName string, toolArgs map[string]string) string {
+	switch toolName {
+	case "shell":
+		return "Running: " + toolArgs["command"]
+	case "grep":
+		return fmt.Sprintf("Searching %s for %q", toolArgs["path"], toolArgs["pattern"])
+	case "tree":
+		return "Listing tree of " + toolArgs["path"]
+	case "list":
+		return "Listing files"
+	case "pwd":
+		return "Checking working directory"
+	case "delete_file":
+		return "Deleting " + toolArgs["path"]
+	case "read_file":
+		return "Reading " + toolArgs["path"]
+	case "write_file":
+		return "Writing " + toolArgs["path"]
+	case "mkdir":
+		return "Creating directory " + toolArgs["path"]
+	case "git_status":
+		return "Checking git status"
+	case "git_diff":
+		if toolArgs["staged"] == "true" {
+			return "Diffing staged changes " + toolArgs["paths"]
+		}
+		return "Diffing changes " + toolArgs["paths"]
+	case "git_log":
+		return "Reading git log " + toolArgs["path"]
+	case "git_blame":
+		return "Blaming " + toolArgs["path"]
+	case "git_show":
+		return "Showing commit " + toolArgs["revision"]
+	case "git_commit":
+		subject, _, _ := strings.Cut(toolArgs["message"], "\n")
+		return "Committing: " + subject
+	case "lsp_definition":
+		return fmt.Sprintf("Finding definition of %s in %s", lspSymbol(toolArgs), toolArgs["path"])
+	case "lsp_references":
+		return fmt.Sprintf("Finding references to %s in %s", lspSymbol(toolArgs), toolArgs["path"])
+	case "lsp_hover":
+		return fmt.Sprintf("Inspecting %s in %s", lspSymbol(toolArgs), toolArgs["path"])
+	case "lsp_symbols":
+		return "Outlining " + toolArgs["path"]
+	case "lsp_workspace_symbols":
+		return fmt.Sprintf("Searching symbols for %q", toolArgs["query"])
+	case "lsp_rename":
+		return fmt.Sprintf("Renaming %s to %s", lspSymbol(toolArgs), toolArgs["new_name"])
+	case "lsp_diagnostics":
+		if toolArgs["path"] == "" {
+			return "Checking diagnostics"
+		}
+		return "Checking diagnostics of " + toolArgs["path"]
+	default:
+		return "Running tool " + toolName
+	}
+}
+
+// lspSymbol names the symbol of an LSP tool call, or its position
+func lspSymbol(toolArgs map[string]string) string {
+	if toolArgs["symbol"] != "" {
+		return toolArgs["symbol"]
+	}
+	return fmt.Sprintf("line %s column %s", toolArgs["line"], toolArgs["column"])
+}
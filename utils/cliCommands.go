@@ -2,8 +2,10 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/KacemMathlouthi/go-code/config"
+	"github.com/KacemMathlouthi/go-code/lsp"
 )
 
 const asciiArt = `
@@ -22,28 +24,23 @@ const asciiArt = `
 func GetStartupText() {
 	fmt.Print(ColorRed + asciiArt + ColorReset)
 	fmt.Println(ColorGreen + ColorBold + "Welcome! I'm your coding agent. Ask me to create, fix or explain anything!" + ColorReset)
-	fmt.Println(ColorCyan + "Type '--help' to see the available commands." + ColorReset)
+	fmt.Println(ColorCyan + "Type '/help' to see the available commands." + ColorReset)
 	fmt.Println()
 }
 
-func GetHelpText() {
-	fmt.Println(ColorYellow + ColorBold + "Available commands:" + ColorReset)
-	fmt.Println("  - Type any text to get a response from the AI agent")
-	fmt.Println("  - Type '--clear' to clear conversation history")
-	fmt.Println("  - Type '--config' to show the current llm model and tools")
-	fmt.Println("  - Type '--help' to show this help message")
-	fmt.Println("  - Type '--quit' to exit")
-	fmt.Println()
-}
-
-func GetConfigText() {
+// GetConfigText prints the configuration and the tools, model is the model
+// the session currently uses
+func GetConfigText(model string) {
 	AzureOpenAIConfig := config.LoadEnvConfig()
 
 	fmt.Println(ColorYellow + ColorBold + "Current Configuration:" + ColorReset)
-	fmt.Printf("  LLM model: %v\n", AzureOpenAIConfig.DeploymentName)
+	fmt.Printf("  LLM model: %v\n", model)
+	fmt.Printf("  Fallback models: %v\n", strings.Join(AzureOpenAIConfig.FallbackDeployments, ", "))
 	fmt.Printf("  API version: %v\n", AzureOpenAIConfig.APIVersion)
-	fmt.Printf("  API key: %v\n", AzureOpenAIConfig.APIKey)
+	fmt.Printf("  API key: %v\n", MaskSecret(AzureOpenAIConfig.APIKey))
 	fmt.Printf("  API endpoint: %v\n", AzureOpenAIConfig.Endpoint)
+	fmt.Printf("  Max iterations: %v\n", AzureOpenAIConfig.MaxIterations)
+	fmt.Printf("  Log file: %v\n", LogFilePath())
 
 	fmt.Println(ColorYellow + ColorBold + "\nAvailable tools:" + ColorReset)
 	fmt.Println("  - list: List files in the current directory")
@@ -54,4 +51,12 @@ func GetConfigText() {
 	fmt.Println("  - write_file: Write to a file")
 	fmt.Println("  - read_file: Read a file")
 	fmt.Println("  - delete_file: Delete a file")
+	fmt.Println("  - git_status, git_diff, git_log, git_blame, git_show: Inspect the git repository")
+	fmt.Println("  - git_commit: Commit changes (asks for approval unless --allow-commits)")
+	if languages := lsp.Languages(); len(languages) > 0 {
+		fmt.Printf("  - lsp_definition, lsp_references, lsp_hover, lsp_symbols, lsp_workspace_symbols, lsp_diagnostics: Code intelligence (%v)\n", strings.Join(languages, ", "))
+		fmt.Println("  - lsp_rename: Rename a symbol across the workspace (asks for approval with --approve-diffs)")
+	} else {
+		fmt.Println("  - lsp_*: Code intelligence, unavailable, no language server such as gopls is installed")
+	}
 }
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxCompletions caps the candidates returned for a single completion
+const maxCompletions = 100
+
+// CompletePath returns the files and directories starting with word.
+// Directories end with a slash so completion can continue inside them.
+func CompletePath(word string) []string {
+	dir, prefix := filepath.Split(word)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	if strings.HasPrefix(readDir, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			readDir = filepath.Join(home, readDir[2:])
+		}
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+		if entry.IsDir() {
+			name += "/"
+		}
+		candidates = append(candidates, dir+name)
+		if len(candidates) == maxCompletions {
+			break
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// CompleteWord returns the candidates from words starting with prefix
+func CompleteWord(prefix string, words []string) []string {
+	var candidates []string
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			candidates = append(candidates, word)
+		}
+	}
+	return candidates
+}
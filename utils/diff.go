@@ -0,0 +1,260 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// diffContext is the number of unchanged lines shown around each change
+	diffContext = 3
+	// maxDiffCells bounds the LCS table; larger changes are shown as a full rewrite
+	maxDiffCells = 4_000_000
+)
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff returns a unified diff between the old and new content of path,
+// or an empty string when they are identical
+func UnifiedDiff(path, oldContent, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+
+	oldLines := splitDiffLines(oldContent)
+	newLines := splitDiffLines(newContent)
+	ops := diffLines(oldLines, newLines)
+
+	oldName, newName := "a/"+path, "b/"+path
+	if oldContent == "" {
+		oldName = "/dev/null"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for _, hunk := range diffHunks(ops) {
+		b.WriteString(hunk)
+	}
+	return b.String()
+}
+
+// FormatDiff colors a unified diff for the terminal. Unless exact is set,
+// secrets are masked and the lines holding one are marked. A diff shown for
+// approval is exact, so the user reviews what will be written.
+func FormatDiff(diff string, exact bool) string {
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	masked := make([]bool, len(lines))
+	if !exact {
+		redacted := strings.Split(strings.TrimRight(Redact(diff), "\n"), "\n")
+		if len(redacted) == len(lines) {
+			for i := range lines {
+				masked[i] = redacted[i] != lines[i]
+			}
+		} else {
+			// A multi-line secret such as a private key was folded, the lines
+			// can't be matched anymore
+			masked = make([]bool, len(redacted))
+			masked[0] = true
+		}
+		lines = redacted
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			b.WriteString(ColorBold + line + ColorReset)
+		case strings.HasPrefix(line, "@@"):
+			b.WriteString(ColorCyan + line + ColorReset)
+		case strings.HasPrefix(line, "+"):
+			b.WriteString(ColorGreen + line + ColorReset)
+		case strings.HasPrefix(line, "-"):
+			b.WriteString(ColorRed + line + ColorReset)
+		default:
+			b.WriteString(ColorDim + line + ColorReset)
+		}
+		if masked[i] {
+			b.WriteString(ColorYellow + "  ⚠ secret masked" + ColorReset)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// DiffStats counts the added and removed lines of a unified diff
+func DiffStats(diff string) (added, removed int) {
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+func splitDiffLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines computes a line edit script using the longest common subsequence
+// of the lines that differ between the common prefix and suffix
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA)*len(midB) > maxDiffCells {
+		for _, line := range midA {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, lcsDiff(midA, midB)...)
+	}
+
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+func lcsDiff(a, b []string) []diffOp {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// diffHunks groups an edit script into unified diff hunks with context lines
+func diffHunks(ops []diffOp) []string {
+	var hunks []string
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are closer than twice the context
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			gap := end
+			for gap < len(ops) && ops[gap].kind == ' ' {
+				gap++
+			}
+			if gap == len(ops) || gap-end > 2*diffContext {
+				break
+			}
+			end = gap
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext, len(ops))
+
+		// Line numbers are 1-based positions in the old and new files
+		oldLine, newLine := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldLine++
+			}
+			if op.kind != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+			body.WriteString(string(op.kind) + op.text + "\n")
+		}
+		if oldCount == 0 {
+			oldLine--
+		}
+		if newCount == 0 {
+			newLine--
+		}
+
+		hunks = append(hunks, fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)+body.String())
+		start = to
+	}
+	return hunks
+}
+
+// FileWriteDiff returns the diff that writing content to path would produce.
+// A missing file diffs against empty content.
+func FileWriteDiff(path, content string) string {
+	previous, err := os.ReadFile(path)
+	if err != nil {
+		previous = nil
+	}
+	return UnifiedDiff(path, string(previous), content)
+}
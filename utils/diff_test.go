@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "new file",
+			old:  "",
+			new:  "a\nb\n",
+			want: "--- /dev/null\n+++ b/f.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "changed line with context",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:  "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes make two hunks",
+			old:  "a\n1\n2\n3\n4\n5\n6\n7\n8\nb\n",
+			new:  "A\n1\n2\n3\n4\n5\n6\n7\n8\nB\n",
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+		{
+			name: "deleted content",
+			old:  "a\nb\n",
+			new:  "",
+			want: "--- a/f.txt\n+++ b/f.txt\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := UnifiedDiff("f.txt", test.old, test.new); got != test.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiffStats(t *testing.T) {
+	diff := "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n+C\n"
+	added, removed := DiffStats(diff)
+	if added != 2 || removed != 1 {
+		t.Errorf("DiffStats() = +%d -%d, want +2 -1", added, removed)
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	diff := UnifiedDiff("config.go", "package config\n", "package config\n\nconst apiKey = \"Zx9Qw2Lm8Rt5Yp\"\n")
+
+	exact := stripANSI(FormatDiff(diff, true))
+	if !strings.Contains(exact, "Zx9Qw2Lm8Rt5Yp") || strings.Contains(exact, "secret masked") {
+		t.Errorf("FormatDiff(exact) = %q, want the secret shown unmarked", exact)
+	}
+
+	masked := stripANSI(FormatDiff(diff, false))
+	if strings.Contains(masked, "Zx9Qw2Lm8Rt5Yp") {
+		t.Errorf("FormatDiff() = %q, secret not masked", masked)
+	}
+	for _, line := range strings.Split(strings.TrimRight(masked, "\n"), "\n") {
+		marked := strings.HasSuffix(line, "⚠ secret masked")
+		if marked != strings.Contains(line, redactedText) {
+			t.Errorf("FormatDiff() line %q: marked %v, want it marked only when masked", line, marked)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// syntax describes how to highlight one language
+type syntax struct {
+	keywords      map[string]bool
+	lineComments  []string
+	stringQuotes  string
+	highlightKeys bool
+}
+
+func words(list string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(list) {
+		set[word] = true
+	}
+	return set
+}
+
+var (
+	goSyntax = syntax{
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if import
+			interface map package range return select struct switch type var nil true false iota error string int
+			int64 int32 uint uint64 byte rune bool float64 float32 any make new len cap append panic recover`),
+		lineComments: []string{"//"},
+		stringQuotes: "\"'`",
+	}
+	pythonSyntax = syntax{
+		keywords: words(`and as assert async await break class continue def del elif else except finally for from
+			global if import in is lambda nonlocal not or pass raise return try while with yield None True False self`),
+		lineComments: []string{"#"},
+		stringQuotes: "\"'",
+	}
+	jsSyntax = syntax{
+		keywords: words(`async await break case catch class const continue debugger default delete do else export
+			extends finally for from function if import in instanceof let new of return super switch this throw try
+			typeof var void while yield null undefined true false interface type enum implements readonly`),
+		lineComments: []string{"//"},
+		stringQuotes: "\"'`",
+	}
+	rustSyntax = syntax{
+		keywords: words(`as async await break const continue crate else enum extern false fn for if impl in let loop
+			match mod move mut pub ref return self Self static struct super trait true type unsafe use where while
+			Some None Ok Err`),
+		lineComments: []string{"//"},
+		stringQuotes: "\"",
+	}
+	cSyntax = syntax{
+		keywords: words(`auto break case char class const continue default delete do double else enum extern final
+			float for goto if import int long new null package private protected public return short signed sizeof
+			static struct switch this throw try typedef union unsigned void volatile while true false catch boolean
+			string String var override namespace template typename using`),
+		lineComments: []string{"//"},
+		stringQuotes: "\"'",
+	}
+	shellSyntax = syntax{
+		keywords:     words(`if then else elif fi for while do done case esac in function return export local echo cd exit`),
+		lineComments: []string{"#"},
+		stringQuotes: "\"'",
+	}
+	sqlSyntax = syntax{
+		keywords: words(`select from where insert into values update set delete create table drop alter index join
+			left right inner outer on group by order having limit and or not null as distinct primary key
+			SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN LEFT RIGHT
+			INNER OUTER ON GROUP BY ORDER HAVING LIMIT AND OR NOT NULL AS DISTINCT PRIMARY KEY`),
+		lineComments: []string{"--"},
+		stringQuotes: "'\"",
+	}
+	dataSyntax = syntax{
+		keywords:      words(`true false null`),
+		lineComments:  []string{"#"},
+		stringQuotes:  "\"'",
+		highlightKeys: true,
+	}
+)
+
+// syntaxes maps fenced code block languages to their syntax
+var syntaxes = map[string]syntax{
+	"go": goSyntax, "golang": goSyntax,
+	"python": pythonSyntax, "py": pythonSyntax,
+	"javascript": jsSyntax, "js": jsSyntax, "jsx": jsSyntax,
+	"typescript": jsSyntax, "ts": jsSyntax, "tsx": jsSyntax,
+	"rust": rustSyntax, "rs": rustSyntax,
+	"c": cSyntax, "cpp": cSyntax, "c++": cSyntax, "java": cSyntax, "kotlin": cSyntax, "csharp": cSyntax, "cs": cSyntax,
+	"sh": shellSyntax, "bash": shellSyntax, "shell": shellSyntax, "zsh": shellSyntax, "console": shellSyntax,
+	"sql":  sqlSyntax,
+	"json": dataSyntax, "yaml": dataSyntax, "yml": dataSyntax, "toml": dataSyntax,
+}
+
+// HighlightCode colors a single line of code: keywords, strings, numbers and
+// comments. Unknown languages are returned unchanged.
+func HighlightCode(line, language string) string {
+	lang, ok := syntaxes[strings.ToLower(language)]
+	if !ok {
+		return line
+	}
+
+	runes := []rune(line)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+
+		// Line comments run to the end of the line
+		if hasAnyPrefix(rest, lang.lineComments) {
+			b.WriteString(ColorDim + rest + ColorReset)
+			break
+		}
+
+		r := runes[i]
+		switch {
+		case strings.ContainsRune(lang.stringQuotes, r):
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(runes) {
+				end = len(runes) - 1
+			}
+			literal := string(runes[i : end+1])
+			color := ColorGreen
+			if lang.highlightKeys && strings.HasPrefix(strings.TrimSpace(string(runes[end+1:])), ":") {
+				color = ColorCyan
+			}
+			b.WriteString(color + literal + ColorReset)
+			i = end + 1
+
+		case unicode.IsDigit(r):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.' || runes[end] == '_' || unicode.IsLetter(runes[end])) {
+				end++
+			}
+			b.WriteString(ColorYellow + string(runes[i:end]) + ColorReset)
+			i = end
+
+		case unicode.IsLetter(r) || r == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[i:end])
+			switch {
+			case lang.keywords[word]:
+				b.WriteString(ColorMagenta + word + ColorReset)
+			case lang.highlightKeys && strings.HasPrefix(strings.TrimSpace(string(runes[end:])), ":"):
+				b.WriteString(ColorCyan + word + ColorReset)
+			case end < len(runes) && runes[end] == '(':
+				b.WriteString(ColorBlue + word + ColorReset)
+			default:
+				b.WriteString(word)
+			}
+			i = end
+
+		default:
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
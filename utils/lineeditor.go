@@ -0,0 +1,544 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// maxHistoryEntries is how many history entries are kept on disk
+const maxHistoryEntries = 1000
+
+// continuationPrompt prefixes the continuation lines of a multiline input
+func continuationPrompt() string {
+	return ColorDim + "… " + ColorReset
+}
+
+// Completer returns completion candidates for the text before the cursor,
+// along with the rune offset where the completed word starts
+type Completer func(line string, cursor int) (start int, candidates []string)
+
+// LineEditor reads user input with line editing, persistent history,
+// multiline input (Alt-Enter or a trailing backslash), bracketed paste and
+// tab completion. When stdin is not a terminal it reads plain lines.
+type LineEditor struct {
+	Completer Completer
+
+	reader      *bufio.Reader
+	interactive bool
+	history     []string
+	historyPath string
+
+	// state of the line being edited
+	lineBuffer
+	prompt    string
+	width     int
+	cursorRow int
+}
+
+// lineBuffer is the text being edited and the cursor position in it
+type lineBuffer struct {
+	buffer []rune
+	cursor int
+}
+
+// NewLineEditor creates an editor on stdin, loading history from historyPath
+// when it is not empty
+func NewLineEditor(historyPath string) *LineEditor {
+	e := &LineEditor{
+		reader:      bufio.NewReader(os.Stdin),
+		interactive: IsTerminal(os.Stdin) && IsTerminal(os.Stdout),
+		historyPath: historyPath,
+	}
+	e.loadHistory()
+	return e
+}
+
+// ReadLine shows prompt and returns the line entered by the user. It returns
+// io.EOF on Ctrl-D or end of input and ErrInterrupted on Ctrl-C.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if !e.interactive {
+		return e.readPlainLine(prompt)
+	}
+
+	restore, err := enableRawMode()
+	if err != nil {
+		return e.readPlainLine(prompt)
+	}
+	fmt.Print("\033[?2004h") // enable bracketed paste
+	defer func() {
+		fmt.Print("\033[?2004l")
+		restore()
+	}()
+
+	e.prompt = prompt
+	e.width = TerminalWidth()
+	e.buffer = nil
+	e.cursor = 0
+	e.cursorRow = 0
+	historyIndex := len(e.history)
+	draft := ""
+	e.render()
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r':
+			// A trailing backslash continues the input on a new line
+			if e.cursor == len(e.buffer) && e.cursor > 0 && e.buffer[e.cursor-1] == '\\' {
+				e.buffer = e.buffer[:e.cursor-1]
+				e.cursor--
+				e.insert([]rune{'\n'})
+				break
+			}
+			e.cursor = len(e.buffer)
+			e.render()
+			fmt.Print("\r\n")
+			return string(e.buffer), nil
+		case '\n': // Ctrl-J
+			e.insert([]rune{'\n'})
+		case 3: // Ctrl-C
+			fmt.Print("^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(e.buffer) == 0 {
+				fmt.Print("\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.cursor)
+		case 1: // Ctrl-A
+			e.cursor = e.lineStart()
+		case 5: // Ctrl-E
+			e.cursor = e.lineEnd()
+		case 2: // Ctrl-B
+			e.move(-1)
+		case 6: // Ctrl-F
+			e.move(1)
+		case 11: // Ctrl-K
+			e.killToLineEnd()
+		case 21: // Ctrl-U
+			e.killToLineStart()
+		case 23: // Ctrl-W
+			e.killWord()
+		case 12: // Ctrl-L
+			fmt.Print("\033[H\033[2J")
+			e.cursorRow = 0
+		case 127, 8: // Backspace
+			e.backspace()
+		case '\t':
+			e.complete()
+		case 27:
+			key := readEscapeKey(e.reader)
+			switch key {
+			case "alt-enter":
+				e.insert([]rune{'\n'})
+			case "left":
+				e.move(-1)
+			case "right":
+				e.move(1)
+			case "home":
+				e.cursor = e.lineStart()
+			case "end":
+				e.cursor = e.lineEnd()
+			case "delete":
+				e.deleteAt(e.cursor)
+			case "paste":
+				e.insert(readPastedText(e.reader))
+			case "up", "down":
+				if key == "up" && historyIndex > 0 {
+					if historyIndex == len(e.history) {
+						draft = string(e.buffer)
+					}
+					historyIndex--
+				} else if key == "down" && historyIndex < len(e.history) {
+					historyIndex++
+				} else {
+					continue
+				}
+				entry := draft
+				if historyIndex < len(e.history) {
+					entry = e.history[historyIndex]
+				}
+				e.set(entry)
+			}
+		default:
+			if r >= 32 {
+				e.insert([]rune{r})
+			}
+		}
+		e.render()
+	}
+}
+
+// AddHistory records an entry in memory and in the history file
+func (e *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistoryEntries {
+		e.history = e.history[len(e.history)-maxHistoryEntries:]
+	}
+
+	if e.historyPath == "" {
+		return
+	}
+	file, err := os.OpenFile(e.historyPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		LogWarning("Failed to save history", "system", map[string]interface{}{
+			"path":  e.historyPath,
+			"error": err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+	// Entries are quoted so multiline inputs stay on one line
+	fmt.Fprintln(file, strconv.Quote(line))
+}
+
+// History returns the entries recorded so far, oldest first
+func (e *LineEditor) History() []string {
+	return append([]string(nil), e.history...)
+}
+
+// loadHistory reads the most recent entries of the history file
+func (e *LineEditor) loadHistory() {
+	if e.historyPath == "" {
+		return
+	}
+	content, err := os.ReadFile(e.historyPath)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if entry, err := strconv.Unquote(line); err == nil {
+			e.history = append(e.history, entry)
+		}
+	}
+	if len(e.history) > maxHistoryEntries {
+		e.history = e.history[len(e.history)-maxHistoryEntries:]
+		// Compact the file so it doesn't grow forever
+		var b strings.Builder
+		for _, entry := range e.history {
+			b.WriteString(strconv.Quote(entry) + "\n")
+		}
+		os.WriteFile(e.historyPath, []byte(b.String()), 0600)
+	}
+}
+
+// readPlainLine reads a line without editing support, joining lines that
+// end with a backslash
+func (e *LineEditor) readPlainLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	var lines []string
+	for {
+		line, err := e.reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if len(lines) > 0 {
+				return strings.Join(lines, "\n"), nil
+			}
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasSuffix(line, "\\") {
+			lines = append(lines, strings.TrimSuffix(line, "\\"))
+			continue
+		}
+		lines = append(lines, line)
+		return strings.Join(lines, "\n"), nil
+	}
+}
+
+// readEscapeKey decodes the key sent after an ESC byte. Terminals send a
+// sequence in one write, so an ESC with nothing buffered after it was pressed
+// alone and doesn't wait for the next key, and a byte that starts no sequence
+// is left to be read as a key of its own.
+func readEscapeKey(reader *bufio.Reader) string {
+	if reader.Buffered() == 0 {
+		return "escape"
+	}
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		return ""
+	}
+	switch r {
+	case '\r', '\n':
+		return "alt-enter"
+	case 'O':
+		r, _, _ = reader.ReadRune()
+		return map[rune]string{'A': "up", 'B': "down", 'C': "right", 'D': "left", 'H': "home", 'F': "end"}[r]
+	case '[':
+	default:
+		reader.UnreadRune()
+		return ""
+	}
+
+	// CSI sequence: parameters followed by a final byte
+	var params strings.Builder
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return ""
+		}
+		if r >= 0x40 && r <= 0x7e {
+			switch r {
+			case 'A':
+				return "up"
+			case 'B':
+				return "down"
+			case 'C':
+				return "right"
+			case 'D':
+				return "left"
+			case 'H':
+				return "home"
+			case 'F':
+				return "end"
+			case '~':
+				switch params.String() {
+				case "1", "7":
+					return "home"
+				case "4", "8":
+					return "end"
+				case "3":
+					return "delete"
+				case "5":
+					return "pgup"
+				case "6":
+					return "pgdn"
+				case "200":
+					return "paste"
+				}
+			}
+			return ""
+		}
+		params.WriteRune(r)
+	}
+}
+
+// readPastedText reads bracketed paste content up to the end marker
+func readPastedText(reader *bufio.Reader) []rune {
+	const endMarker = "\x1b[201~"
+	var pasted []rune
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			break
+		}
+		pasted = append(pasted, r)
+		if strings.HasSuffix(string(pasted[max(len(pasted)-len(endMarker), 0):]), endMarker) {
+			pasted = pasted[:len(pasted)-len(endMarker)]
+			break
+		}
+	}
+	text := strings.ReplaceAll(string(pasted), "\r\n", "\n")
+	return []rune(strings.ReplaceAll(text, "\r", "\n"))
+}
+
+// complete completes the word under the cursor, listing the candidates below
+// the input when they are ambiguous
+func (e *LineEditor) complete() {
+	candidates := e.completeWith(e.Completer)
+	if len(candidates) > 1 {
+		cursor := e.cursor
+		e.cursor = len(e.buffer)
+		e.render()
+		fmt.Print("\r\n" + ColorDim + strings.Join(candidates, "  ") + ColorReset + "\r\n")
+		e.cursorRow = 0
+		e.cursor = cursor
+	}
+}
+
+// completeWith asks completer for candidates for the word under the cursor and
+// completes as far as they agree. It returns the candidates when they are
+// still ambiguous.
+func (b *lineBuffer) completeWith(completer Completer) []string {
+	if completer == nil {
+		return nil
+	}
+	start, candidates := completer(string(b.buffer[:b.cursor]), b.cursor)
+	if len(candidates) == 0 || start < 0 || start > b.cursor {
+		return nil
+	}
+
+	prefix := []rune(candidates[0])
+	for _, candidate := range candidates[1:] {
+		c := []rune(candidate)
+		n := 0
+		for n < len(prefix) && n < len(c) && prefix[n] == c[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	if len(prefix) > b.cursor-start {
+		rest := append([]rune{}, b.buffer[b.cursor:]...)
+		b.buffer = append(append(b.buffer[:start], prefix...), rest...)
+		b.cursor = start + len(prefix)
+		if len(candidates) == 1 && !strings.HasSuffix(candidates[0], "/") {
+			b.insert([]rune{' '})
+		}
+		return nil
+	}
+	if len(candidates) > 1 {
+		return candidates
+	}
+	return nil
+}
+
+func (b *lineBuffer) insert(runes []rune) {
+	rest := append([]rune{}, b.buffer[b.cursor:]...)
+	b.buffer = append(append(b.buffer[:b.cursor], runes...), rest...)
+	b.cursor += len(runes)
+}
+
+func (b *lineBuffer) deleteAt(pos int) {
+	if pos < len(b.buffer) {
+		b.buffer = append(b.buffer[:pos], b.buffer[pos+1:]...)
+	}
+}
+
+func (b *lineBuffer) backspace() {
+	if b.cursor > 0 {
+		b.cursor--
+		b.deleteAt(b.cursor)
+	}
+}
+
+func (b *lineBuffer) move(delta int) {
+	b.cursor = min(max(b.cursor+delta, 0), len(b.buffer))
+}
+
+// set replaces the text and moves the cursor to its end
+func (b *lineBuffer) set(text string) {
+	b.buffer = []rune(text)
+	b.cursor = len(b.buffer)
+}
+
+// lineStart returns the start of the logical line containing the cursor
+func (b *lineBuffer) lineStart() int {
+	pos := b.cursor
+	for pos > 0 && b.buffer[pos-1] != '\n' {
+		pos--
+	}
+	return pos
+}
+
+// lineEnd returns the end of the logical line containing the cursor
+func (b *lineBuffer) lineEnd() int {
+	pos := b.cursor
+	for pos < len(b.buffer) && b.buffer[pos] != '\n' {
+		pos++
+	}
+	return pos
+}
+
+func (b *lineBuffer) killToLineEnd() {
+	b.buffer = append(b.buffer[:b.cursor], b.buffer[b.lineEnd():]...)
+}
+
+func (b *lineBuffer) killToLineStart() {
+	start := b.lineStart()
+	b.buffer = append(b.buffer[:start], b.buffer[b.cursor:]...)
+	b.cursor = start
+}
+
+// killWord deletes the word before the cursor
+func (b *lineBuffer) killWord() {
+	start := b.cursor
+	for start > 0 && b.buffer[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && b.buffer[start-1] != ' ' && b.buffer[start-1] != '\n' {
+		start--
+	}
+	b.buffer = append(b.buffer[:start], b.buffer[b.cursor:]...)
+	b.cursor = start
+}
+
+// render redraws the prompt and buffer, wrapping at the terminal width, and
+// places the cursor
+func (e *LineEditor) render() {
+	width := e.width
+	var out strings.Builder
+
+	// Go back to the first row of the previous render and clear below
+	if e.cursorRow > 0 {
+		fmt.Fprintf(&out, "\033[%dA", e.cursorRow)
+	}
+	out.WriteString("\r\033[J" + e.prompt)
+
+	row, col := 0, visibleWidth(e.prompt)
+	cursorRow, cursorCol := row, col
+	for i, r := range e.buffer {
+		if r != '\n' && col+runeWidth(r) > width {
+			out.WriteString("\r\n")
+			row++
+			col = 0
+		}
+		if i == e.cursor {
+			cursorRow, cursorCol = row, col
+		}
+		if r == '\n' {
+			out.WriteString("\r\n" + continuationPrompt())
+			row++
+			col = visibleWidth(continuationPrompt())
+			continue
+		}
+		out.WriteRune(r)
+		col += runeWidth(r)
+	}
+	if col >= width {
+		out.WriteString("\r\n")
+		row++
+		col = 0
+	}
+	if e.cursor == len(e.buffer) {
+		cursorRow, cursorCol = row, col
+	}
+
+	// Move from the end of the text to the cursor
+	if row > cursorRow {
+		fmt.Fprintf(&out, "\033[%dA", row-cursorRow)
+	}
+	out.WriteString("\r")
+	if cursorCol > 0 {
+		fmt.Fprintf(&out, "\033[%dC", cursorCol)
+	}
+	e.cursorRow = cursorRow
+
+	fmt.Print(out.String())
+}
+
+// enableRawMode puts the terminal in raw mode and returns a function restoring
+// the previous mode
+func enableRawMode() (func(), error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(state))
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bufio"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadEscapeKey(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+		next  rune
+	}{
+		{"\x1b[A", "up", 0},
+		{"\x1bOD", "left", 0},
+		{"\x1b[3~", "delete", 0},
+		{"\x1b[200~", "paste", 0},
+		{"\x1b\r", "alt-enter", 0},
+		{"\x1b", "escape", 0},
+		{"\x1bx", "", 'x'},
+	}
+	for _, test := range tests {
+		reader := bufio.NewReader(strings.NewReader(test.input))
+		reader.ReadRune() // the ESC byte
+		if got := readEscapeKey(reader); got != test.want {
+			t.Errorf("readEscapeKey(%q) = %q, want %q", test.input, got, test.want)
+		}
+		if test.next != 0 {
+			if r, _, err := reader.ReadRune(); err != nil || r != test.next {
+				t.Errorf("key after %q = %q, %v, want %q", test.input, r, err, test.next)
+			}
+		}
+	}
+}
+
+func TestLineBufferEditing(t *testing.T) {
+	var b lineBuffer
+	b.insert([]rune("héllo world"))
+	b.move(-5)
+	b.insert([]rune("big "))
+	if got := string(b.buffer); got != "héllo big world" || b.cursor != 10 {
+		t.Fatalf("after insert = %q at %d, want %q at 10", got, b.cursor, "héllo big world")
+	}
+
+	b.killWord()
+	if got := string(b.buffer); got != "héllo world" || b.cursor != 6 {
+		t.Errorf("after killWord = %q at %d, want %q at 6", got, b.cursor, "héllo world")
+	}
+	b.backspace()
+	b.deleteAt(b.cursor)
+	if got := string(b.buffer); got != "hélloorld" || b.cursor != 5 {
+		t.Errorf("after backspace and delete = %q at %d, want %q at 5", got, b.cursor, "hélloorld")
+	}
+	b.move(-100)
+	if b.cursor != 0 {
+		t.Errorf("move past the start = %d, want 0", b.cursor)
+	}
+
+	b.set("first line\nsecond line")
+	b.move(-4)
+	if start, end := b.lineStart(), b.lineEnd(); start != 11 || end != 22 {
+		t.Errorf("line bounds = %d, %d, want 11, 22", start, end)
+	}
+	b.killToLineEnd()
+	b.killToLineStart()
+	if got := string(b.buffer); got != "first line\n" || b.cursor != 11 {
+		t.Errorf("after the line kills = %q at %d, want %q at 11", got, b.cursor, "first line\n")
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	e := &LineEditor{historyPath: path}
+	for _, line := range []string{"first", "first", " ", "multi\nline"} {
+		e.AddHistory(line)
+	}
+	want := []string{"first", "multi\nline"}
+	if got := e.History(); !reflect.DeepEqual(got, want) {
+		t.Errorf("History() = %q, want %q without repeats or blank entries", got, want)
+	}
+
+	reloaded := &LineEditor{historyPath: path}
+	reloaded.loadHistory()
+	if got := reloaded.History(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded history = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLogMaxSize is the size in bytes at which a session log is rotated
+	DefaultLogMaxSize = 10 << 20
+	// DefaultLogMaxAge is how long log files are kept
+	DefaultLogMaxAge = 14 * 24 * time.Hour
+	// DefaultLogMaxFiles is how many log files are kept
+	DefaultLogMaxFiles = 50
+	// logRotateAge is the age at which a session log is rotated. Logs of other
+	// sessions are only compressed once they are idle this long, as they may
+	// still be written by another go-code process.
+	logRotateAge = 24 * time.Hour
+
+	logExtension        = ".log"
+	compressedExtension = ".log.gz"
+)
+
+// NewSessionID returns an identifier for a go-code run, sortable by start time
+func NewSessionID() string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// rotatingFile is the log file of a session. When it grows past maxSize or
+// gets older than a day it is compressed to <session>.<n>.log.gz and a new
+// file is started.
+type rotatingFile struct {
+	dir      string
+	session  string
+	maxSize  int64
+	file     *os.File
+	size     int64
+	opened   time.Time
+	rotation int
+}
+
+// openLogFile creates the log directory and opens the log file of session
+func openLogFile(dir, session string, maxSize int64) (*rotatingFile, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{dir: dir, session: session, maxSize: maxSize}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path returns the path of the file currently written
+func (f *rotatingFile) Path() string {
+	return filepath.Join(f.dir, f.session+logExtension)
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.Path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.opened = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	tooLarge := f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize
+	if f.size > 0 && (tooLarge || time.Since(f.opened) > logRotateAge) {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate compresses the current file and starts a new one
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.rotation++
+	rotated := filepath.Join(f.dir, fmt.Sprintf("%s.%d%s", f.session, f.rotation, compressedExtension))
+	compressErr := compressFile(f.Path(), rotated)
+	if err := f.open(); err != nil {
+		return err
+	}
+	return compressErr
+}
+
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
+
+// compressFile gzips src into dst and removes src
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(out)
+	if _, err := io.Copy(writer, in); err != nil {
+		writer.Close()
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// Keep the modification time so retention applies to the original age
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return os.Remove(src)
+}
+
+// cleanupLogs compresses the idle logs of previous sessions, then deletes the
+// compressed files older than maxAge and the oldest ones beyond maxFiles. The
+// file of the current session is never touched.
+func cleanupLogs(dir, current string, maxAge time.Duration, maxFiles int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if entry.IsDir() || path == current {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(name, logExtension) {
+			if time.Since(info.ModTime()) < logRotateAge {
+				continue
+			}
+			compressed := strings.TrimSuffix(path, logExtension) + compressedExtension
+			if err := compressFile(path, compressed); err != nil {
+				return err
+			}
+			path = compressed
+		} else if !strings.HasSuffix(name, compressedExtension) {
+			continue
+		}
+		files = append(files, logFile{path, info.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for i, file := range files {
+		expired := maxAge > 0 && time.Since(file.modTime) > maxAge
+		// The current session's file counts towards the limit
+		if expired || (maxFiles > 0 && i+1 >= maxFiles) {
+			os.Remove(file.path)
+		}
+	}
+	return nil
+}
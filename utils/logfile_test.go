@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRotatingFileRotatesWhenFull(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openLogFile(dir, "session", 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first line\n", "second line\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := readGzip(t, filepath.Join(dir, "session.1.log.gz")); got != "first line\n" {
+		t.Errorf("first rotation = %q, want %q", got, "first line\n")
+	}
+	current, err := os.ReadFile(f.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(current); got != "second line\nthird\n" {
+		t.Errorf("current file = %q, want the lines written after the rotation", got)
+	}
+}
+
+func TestCleanupLogs(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	create := func(name, content string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	current := create("current.log", "running", 3*logRotateAge)
+	create("active.log", "another process", time.Minute)
+	create("idle.log", "idle session", 2*logRotateAge)
+	create("expired.log.gz", "", 30*24*time.Hour)
+	create("notes.txt", "not a log", 30*24*time.Hour)
+
+	if err := cleanupLogs(dir, current, 14*24*time.Hour, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if got, want := strings.Join(names, " "), "active.log current.log idle.log.gz notes.txt"; got != want {
+		t.Errorf("files after cleanup = %s, want %s", got, want)
+	}
+	if got := readGzip(t, filepath.Join(dir, "idle.log.gz")); got != "idle session" {
+		t.Errorf("compressed idle log = %q, want its content", got)
+	}
+}
+
+func TestCleanupLogsKeepsMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"a.log.gz", "b.log.gz", "c.log.gz", "d.log.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Now().Add(-time.Duration(i+1) * time.Hour)
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	// The current session's file counts towards the limit
+	if err := cleanupLogs(dir, filepath.Join(dir, "current.log"), 0, 3); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if got, want := strings.Join(names, " "), "a.log.gz b.log.gz"; got != want {
+		t.Errorf("files after cleanup = %s, want the newest %s", got, want)
+	}
+}
@@ -3,9 +3,13 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/KacemMathlouthi/go-code/config"
 )
 
 // LogLevel represents the logging level
@@ -16,31 +20,106 @@ const (
 	INFO    LogLevel = "INFO"
 	WARNING LogLevel = "WARNING"
 	ERROR   LogLevel = "ERROR"
+	// OFF disables a log output
+	OFF LogLevel = "OFF"
 )
 
+// levelRank orders the levels from the most to the least verbose
+var levelRank = map[LogLevel]int{DEBUG: 0, INFO: 1, WARNING: 2, ERROR: 3, OFF: 4}
+
+// ParseLogLevel parses a level name such as "info" or "warn"
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARNING", "WARN":
+		return WARNING, nil
+	case "ERROR":
+		return ERROR, nil
+	case "OFF", "NONE":
+		return OFF, nil
+	}
+	return "", fmt.Errorf("invalid log level %q, use debug, info, warning, error or off", name)
+}
+
+// enabled reports whether an entry at level passes the threshold
+func (threshold LogLevel) enabled(level LogLevel) bool {
+	return levelRank[level] >= levelRank[threshold] && threshold != OFF
+}
+
+// LoggerOptions sets the thresholds of the log file and the console, and
+// where session log files are kept
+type LoggerOptions struct {
+	FileLevel    LogLevel
+	ConsoleLevel LogLevel
+	// Console receives the console logs, stdout when nil
+	Console io.Writer
+
+	// Dir holds the log files, config.LogDir() when empty
+	Dir string
+	// SessionID names the log file, a new ID when empty
+	SessionID string
+	// MaxSize in bytes, MaxAge and MaxFiles bound the log files; zero values
+	// use the defaults and negative ones disable the limit
+	MaxSize  int64
+	MaxAge   time.Duration
+	MaxFiles int
+}
+
 // LogEntry represents a structured log entry
 type LogEntry struct {
 	Timestamp string                 `json:"timestamp"`
 	Level     LogLevel               `json:"level"`
 	Message   string                 `json:"message"`
 	Category  string                 `json:"category,omitempty"`
+	Session   string                 `json:"session,omitempty"`
 	Data      map[string]interface{} `json:"data,omitempty"`
 }
 
 // Logger handles logging operations
 type Logger struct {
 	fileLogger *log.Logger
-	file       *os.File
+	file       *rotatingFile
+	options    LoggerOptions
 }
 
-var (
-	globalLogger *Logger
-	logFile      = "app.log"
-)
+var globalLogger *Logger
 
 // InitLogger initializes the global logger
-func InitLogger() error {
-	file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+func InitLogger(options LoggerOptions) error {
+	if options.FileLevel == "" {
+		options.FileLevel = INFO
+	}
+	if options.ConsoleLevel == "" {
+		options.ConsoleLevel = OFF
+	}
+	if options.Dir == "" {
+		dir, err := config.LogDir()
+		if err != nil {
+			return fmt.Errorf("failed to locate log directory: %v", err)
+		}
+		options.Dir = dir
+	}
+	if options.SessionID == "" {
+		options.SessionID = NewSessionID()
+	}
+	if options.MaxSize == 0 {
+		options.MaxSize = DefaultLogMaxSize
+	}
+	if options.MaxAge == 0 {
+		options.MaxAge = DefaultLogMaxAge
+	}
+	if options.MaxFiles == 0 {
+		options.MaxFiles = DefaultLogMaxFiles
+	}
+
+	// The .env file is loaded by LoadEnvConfig, so its secrets are registered too
+	RegisterSecret(config.LoadEnvConfig().APIKey)
+	RegisterEnvSecrets()
+
+	file, err := openLogFile(options.Dir, options.SessionID, options.MaxSize)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
 	}
@@ -48,13 +127,38 @@ func InitLogger() error {
 	globalLogger = &Logger{
 		fileLogger: log.New(file, "", 0),
 		file:       file,
+		options:    options,
 	}
 
 	// Log initialization
-	globalLogger.Log(INFO, "Logger initialized", "system", nil)
+	globalLogger.Log(INFO, "Logger initialized", "system", map[string]interface{}{
+		"session": options.SessionID,
+		"path":    file.Path(),
+	})
+	if err := cleanupLogs(options.Dir, file.Path(), options.MaxAge, options.MaxFiles); err != nil {
+		globalLogger.Log(WARNING, "Failed to clean up old logs", "system", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
 	return nil
 }
 
+// SessionID returns the identifier of the current session's log
+func SessionID() string {
+	if globalLogger == nil {
+		return ""
+	}
+	return globalLogger.options.SessionID
+}
+
+// LogFilePath returns the log file of the current session
+func LogFilePath() string {
+	if globalLogger == nil {
+		return ""
+	}
+	return globalLogger.file.Path()
+}
+
 // CloseLogger closes the log file
 func CloseLogger() {
 	if globalLogger != nil && globalLogger.file != nil {
@@ -64,11 +168,26 @@ func CloseLogger() {
 
 // Log writes a structured log entry
 func (l *Logger) Log(level LogLevel, message, category string, data map[string]interface{}) {
+	// Secrets never reach the console or the log file
+	message = Redact(message)
+	data = redactData(data)
+
+	if l.options.FileLevel.enabled(level) {
+		l.writeFile(level, message, category, data)
+	}
+	if l.options.ConsoleLevel.enabled(level) {
+		l.writeConsole(level, message, category, data)
+	}
+}
+
+// writeFile appends an entry to the log file as a JSON line
+func (l *Logger) writeFile(level LogLevel, message, category string, data map[string]interface{}) {
 	entry := LogEntry{
-		Timestamp: time.Now().Format(time.RFC3339),
+		Timestamp: time.Now().Format(time.RFC3339Nano),
 		Level:     level,
 		Message:   message,
 		Category:  category,
+		Session:   l.options.SessionID,
 		Data:      data,
 	}
 
@@ -82,11 +201,18 @@ func (l *Logger) Log(level LogLevel, message, category string, data map[string]i
 
 	// Write to file
 	l.fileLogger.Println(string(jsonData))
+}
 
-	// Also print to console for development
-	fmt.Printf("[%s] %s: %s\n", level, category, message)
-	if data != nil {
-		fmt.Printf("  Data: %+v\n", data)
+// writeConsole prints an entry on one line, with its data only when the
+// console shows debug logs
+func (l *Logger) writeConsole(level LogLevel, message, category string, data map[string]interface{}) {
+	console := l.options.Console
+	if console == nil {
+		console = os.Stdout
+	}
+	fmt.Fprintf(console, "%s[%s] %s: %s%s\n", ColorDim, level, category, message, ColorReset)
+	if data != nil && l.options.ConsoleLevel == DEBUG {
+		fmt.Fprintf(console, "%s  Data: %+v%s\n", ColorDim, data, ColorReset)
 	}
 }
 
@@ -156,10 +282,12 @@ func LogToolCall(toolName string, toolArgs map[string]string) {
 	})
 }
 
-func LogToolResult(toolName string, result string, err error) {
+func LogToolResult(toolName string, result string, err error, duration time.Duration) {
 	data := map[string]interface{}{
-		"tool_name": toolName,
-		"result":    result,
+		"tool_name":   toolName,
+		"result":      result,
+		"duration":    duration.String(),
+		"duration_ms": duration.Milliseconds(),
 	}
 
 	if err != nil {
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogSession is the set of log files written by one go-code run
+type LogSession struct {
+	ID string
+	// Files are in the order they were written
+	Files   []string
+	Size    int64
+	ModTime time.Time
+}
+
+// LogFilter selects log entries; zero fields match everything
+type LogFilter struct {
+	MinLevel LogLevel
+	Category string
+	Since    time.Time
+	Until    time.Time
+}
+
+// Time returns the time of the entry, or the zero time when it can't be parsed
+func (e LogEntry) Time() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, e.Timestamp)
+	return t
+}
+
+// Matches reports whether the entry passes the filter
+func (f LogFilter) Matches(entry LogEntry) bool {
+	if f.MinLevel != "" && levelRank[entry.Level] < levelRank[f.MinLevel] {
+		return false
+	}
+	if f.Category != "" && !strings.EqualFold(f.Category, entry.Category) {
+		return false
+	}
+	t := entry.Time()
+	if !f.Since.IsZero() && t.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && t.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// ListLogSessions returns the sessions logged in dir, most recent first
+func ListLogSessions(dir string) ([]LogSession, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	type part struct {
+		path     string
+		rotation int
+	}
+	parts := map[string][]part{}
+	sessions := map[string]*LogSession{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var base string
+		switch {
+		case strings.HasSuffix(name, compressedExtension):
+			base = strings.TrimSuffix(name, compressedExtension)
+		case strings.HasSuffix(name, logExtension):
+			base = strings.TrimSuffix(name, logExtension)
+		default:
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+
+		// Rotated files are named <session>.<n>; the unnumbered file is the latest
+		id, number, _ := strings.Cut(base, ".")
+		rotation, err := strconv.Atoi(number)
+		if err != nil {
+			rotation = int(^uint(0) >> 1)
+		}
+		parts[id] = append(parts[id], part{filepath.Join(dir, name), rotation})
+
+		session := sessions[id]
+		if session == nil {
+			session = &LogSession{ID: id}
+			sessions[id] = session
+		}
+		session.Size += info.Size()
+		if info.ModTime().After(session.ModTime) {
+			session.ModTime = info.ModTime()
+		}
+	}
+
+	var result []LogSession
+	for id, session := range sessions {
+		files := parts[id]
+		sort.Slice(files, func(i, j int) bool { return files[i].rotation < files[j].rotation })
+		for _, file := range files {
+			session.Files = append(session.Files, file.path)
+		}
+		result = append(result, *session)
+	}
+	// Session IDs start with their creation time
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	return result, nil
+}
+
+// FindLogSession picks a session by ID, unique ID prefix, or "last"
+func FindLogSession(sessions []LogSession, name string) (LogSession, error) {
+	if len(sessions) == 0 {
+		return LogSession{}, fmt.Errorf("no session logs found")
+	}
+	if name == "last" || name == "latest" {
+		return sessions[0], nil
+	}
+
+	var matches []LogSession
+	for _, session := range sessions {
+		if session.ID == name {
+			return session, nil
+		}
+		if strings.HasPrefix(session.ID, name) {
+			matches = append(matches, session)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return LogSession{}, fmt.Errorf("no session matches %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return LogSession{}, fmt.Errorf("%d sessions match %q, use a longer prefix", len(matches), name)
+	}
+}
+
+// ReadLogEntries reads the entries of a session that pass the filter. Lines
+// that are not JSON entries are skipped.
+func ReadLogEntries(session LogSession, filter LogFilter) ([]LogEntry, error) {
+	var entries []LogEntry
+	for _, path := range session.Files {
+		err := readLogFile(path, func(entry LogEntry) {
+			if filter.Matches(entry) {
+				entries = append(entries, entry)
+			}
+		})
+		if err != nil {
+			return entries, fmt.Errorf("failed to read %s: %v", path, err)
+		}
+	}
+	return entries, nil
+}
+
+func readLogFile(path string, handle func(LogEntry)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	// Entries hold whole files and LLM responses
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for scanner.Scan() {
+		var entry LogEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Timestamp != "" {
+			handle(entry)
+		}
+	}
+	return scanner.Err()
+}
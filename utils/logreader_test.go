@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func writeLog(t *testing.T, path, content string) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if filepath.Ext(path) != ".gz" {
+		if _, err := file.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	writer := gzip.NewWriter(file)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListLogSessions(t *testing.T) {
+	dir := t.TempDir()
+	writeLog(t, filepath.Join(dir, "20250101-100000-aaaaaa.2.log.gz"), "")
+	writeLog(t, filepath.Join(dir, "20250101-100000-aaaaaa.log"), "")
+	writeLog(t, filepath.Join(dir, "20250101-100000-aaaaaa.1.log.gz"), "")
+	writeLog(t, filepath.Join(dir, "20250102-090000-bbbbbb.log"), "")
+	writeLog(t, filepath.Join(dir, "notes.txt"), "")
+
+	sessions, err := ListLogSessions(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || sessions[0].ID != "20250102-090000-bbbbbb" {
+		t.Fatalf("ListLogSessions() = %+v, want two sessions, the latest first", sessions)
+	}
+	var files []string
+	for _, path := range sessions[1].Files {
+		files = append(files, filepath.Base(path))
+	}
+	want := []string{"20250101-100000-aaaaaa.1.log.gz", "20250101-100000-aaaaaa.2.log.gz", "20250101-100000-aaaaaa.log"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("session files = %q, want %q", files, want)
+	}
+
+	if sessions, err := ListLogSessions(filepath.Join(dir, "missing")); err != nil || sessions != nil {
+		t.Errorf("ListLogSessions() of a missing directory = %v, %v, want nothing", sessions, err)
+	}
+}
+
+func TestFindLogSession(t *testing.T) {
+	sessions := []LogSession{{ID: "20250102-090000-bbbbbb"}, {ID: "20250101-100000-aaaaaa"}, {ID: "20250101-110000-cccccc"}}
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "last", want: "20250102-090000-bbbbbb"},
+		{name: "20250101-100000-aaaaaa", want: "20250101-100000-aaaaaa"},
+		{name: "20250101-11", want: "20250101-110000-cccccc"},
+		{name: "20250101", wantErr: true},
+		{name: "2024", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := FindLogSession(sessions, test.name)
+		if (err != nil) != test.wantErr || got.ID != test.want {
+			t.Errorf("FindLogSession(%q) = %q, %v, want %q", test.name, got.ID, err, test.want)
+		}
+	}
+	if _, err := FindLogSession(nil, "last"); err == nil {
+		t.Errorf("FindLogSession() without sessions succeeded")
+	}
+}
+
+func TestReadLogEntries(t *testing.T) {
+	dir := t.TempDir()
+	rotated := filepath.Join(dir, "s.1.log.gz")
+	current := filepath.Join(dir, "s.log")
+	writeLog(t, rotated, `{"timestamp":"2025-01-01T10:00:00Z","level":"DEBUG","message":"debug","category":"llm"}
+not json
+{"timestamp":"2025-01-01T10:01:00Z","level":"INFO","message":"started","category":"system"}
+`)
+	writeLog(t, current, `{"timestamp":"2025-01-01T10:02:00Z","level":"ERROR","message":"failed","category":"tool"}
+{"level":"ERROR","message":"no timestamp"}
+{"timestamp":"2025-01-01T10:03:00Z","level":"WARNING","message":"slow","category":"llm"}
+`)
+	session := LogSession{ID: "s", Files: []string{rotated, current}}
+
+	tests := []struct {
+		name   string
+		filter LogFilter
+		want   []string
+	}{
+		{"all", LogFilter{}, []string{"debug", "started", "failed", "slow"}},
+		{"level", LogFilter{MinLevel: WARNING}, []string{"failed", "slow"}},
+		{"category", LogFilter{Category: "LLM"}, []string{"debug", "slow"}},
+		{"time range", LogFilter{
+			Since: time.Date(2025, 1, 1, 10, 1, 0, 0, time.UTC),
+			Until: time.Date(2025, 1, 1, 10, 2, 0, 0, time.UTC),
+		}, []string{"started", "failed"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := ReadLogEntries(session, test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var messages []string
+			for _, entry := range entries {
+				messages = append(messages, entry.Message)
+			}
+			if !reflect.DeepEqual(messages, test.want) {
+				t.Errorf("ReadLogEntries() = %q, want %q", messages, test.want)
+			}
+		})
+	}
+}
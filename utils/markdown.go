@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fencePattern       = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+#.-]*)")
+	bulletPattern      = regexp.MustCompile(`^(\s*)([-*+])\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	rulePattern        = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+	tableSepPattern    = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	inlineCodePattern  = regexp.MustCompile("`([^`]+)`")
+	boldPattern        = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern      = regexp.MustCompile(`(^|[^\w*])\*([^*\s][^*]*)\*|(^|[^\w_])_([^_\s][^_]*)_`)
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	ansiPattern        = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+	codePlaceholderFmt = "\x00%d\x00"
+)
+
+// RenderMarkdown renders markdown text for a terminal of the given width:
+// headings, lists, block quotes, tables, links, inline styles and fenced code
+// blocks with syntax highlighting
+func RenderMarkdown(text string, width int) string {
+	if width < 20 {
+		width = 20
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var out []string
+	var paragraph []string
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out = append(out, wrapStyled(renderInline(strings.Join(paragraph, " ")), width, "", "")...)
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// Fenced code block
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			out = append(out, renderCodeBlock(code, m[2])...)
+			continue
+		}
+
+		// Table: a header row followed by a separator row
+		if strings.Contains(line, "|") && i+1 < len(lines) && tableSepPattern.MatchString(lines[i+1]) {
+			flushParagraph()
+			rows := [][]string{splitTableRow(line)}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, splitTableRow(lines[i]))
+			}
+			i--
+			out = append(out, renderTable(rows, width)...)
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			heading := renderInline(m[2])
+			switch len(m[1]) {
+			case 1:
+				out = append(out, ColorMagenta+ColorBold+ColorUnderline+heading+ColorReset)
+			case 2:
+				out = append(out, ColorMagenta+ColorBold+heading+ColorReset)
+			default:
+				out = append(out, ColorCyan+ColorBold+heading+ColorReset)
+			}
+
+		case rulePattern.MatchString(line):
+			flushParagraph()
+			out = append(out, ColorDim+strings.Repeat(Horizontal, width)+ColorReset)
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			quote := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			prefix := ColorDim + Vertical + " " + ColorReset
+			out = append(out, wrapStyled(ColorItalic+renderInline(quote)+ColorReset, width, prefix, prefix)...)
+
+		case bulletPattern.MatchString(line):
+			flushParagraph()
+			m := bulletPattern.FindStringSubmatch(line)
+			indent := strings.Repeat(" ", len(m[1]))
+			out = append(out, wrapStyled(renderInline(m[3]), width, indent+ColorCyan+"• "+ColorReset, indent+"  ")...)
+
+		case orderedPattern.MatchString(line):
+			flushParagraph()
+			m := orderedPattern.FindStringSubmatch(line)
+			indent := strings.Repeat(" ", len(m[1]))
+			marker := m[2] + " "
+			out = append(out, wrapStyled(renderInline(m[3]), width, indent+ColorCyan+marker+ColorReset, indent+strings.Repeat(" ", len(marker)))...)
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushParagraph()
+
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderInline applies inline markdown styles: code spans, bold, italic and links
+func renderInline(text string) string {
+	// Protect code spans from the other inline rules
+	var spans []string
+	text = inlineCodePattern.ReplaceAllStringFunc(text, func(match string) string {
+		spans = append(spans, ColorCyan+strings.Trim(match, "`")+ColorReset)
+		return fmt.Sprintf(codePlaceholderFmt, len(spans)-1)
+	})
+
+	text = linkPattern.ReplaceAllString(text, ColorBlue+ColorUnderline+"$1"+ColorReset+ColorDim+" ($2)"+ColorReset)
+	text = boldPattern.ReplaceAllString(text, ColorBold+"$1$2"+ColorReset)
+	text = italicPattern.ReplaceAllString(text, "$1$3"+ColorItalic+"$2$4"+ColorReset)
+
+	for i, span := range spans {
+		text = strings.Replace(text, fmt.Sprintf(codePlaceholderFmt, i), span, 1)
+	}
+	return text
+}
+
+// renderCodeBlock draws a fenced code block with a language label and highlighting
+func renderCodeBlock(code []string, language string) []string {
+	label := language
+	if label == "" {
+		label = "code"
+	}
+
+	lines := []string{ColorDim + TopLeft + Horizontal + " " + label + ColorReset}
+	for _, line := range code {
+		lines = append(lines, ColorDim+Vertical+ColorReset+" "+HighlightCode(strings.ReplaceAll(line, "\t", "    "), language))
+	}
+	lines = append(lines, ColorDim+BottomLeft+Horizontal+ColorReset)
+	return lines
+}
+
+// splitTableRow splits a markdown table row into trimmed cells
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i, cell := range cells {
+		cells[i] = renderInline(strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// renderTable draws table rows with box-drawing separators, shrinking the
+// widest columns when the table doesn't fit the terminal
+func renderTable(rows [][]string, width int) []string {
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for c, cell := range row {
+			if w := visibleWidth(cell); w > widths[c] {
+				widths[c] = w
+			}
+		}
+	}
+
+	// Each column takes 3 extra cells for padding and separators
+	for total(widths)+3*columns+1 > width {
+		widest := 0
+		for c := range widths {
+			if widths[c] > widths[widest] {
+				widest = c
+			}
+		}
+		if widths[widest] <= 4 {
+			break
+		}
+		widths[widest]--
+	}
+
+	border := func(left, middle, right string) string {
+		parts := make([]string, columns)
+		for c, w := range widths {
+			parts[c] = strings.Repeat(Horizontal, w+2)
+		}
+		return ColorDim + left + strings.Join(parts, middle) + right + ColorReset
+	}
+
+	lines := []string{border(TopLeft, "┬", TopRight)}
+	for r, row := range rows {
+		var b strings.Builder
+		b.WriteString(ColorDim + Vertical + ColorReset)
+		for c, w := range widths {
+			cell := ""
+			if c < len(row) {
+				cell = truncateStyled(row[c], w)
+			}
+			if r == 0 {
+				cell = ColorBold + cell + ColorReset
+			}
+			b.WriteString(" " + cell + strings.Repeat(" ", w-visibleWidth(cell)) + " " + ColorDim + Vertical + ColorReset)
+		}
+		lines = append(lines, b.String())
+		if r == 0 {
+			lines = append(lines, border("├", "┼", "┤"))
+		}
+	}
+	lines = append(lines, border(BottomLeft, "┴", BottomRight))
+	return lines
+}
+
+func total(values []int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+// wrapStyled word-wraps text containing ANSI sequences to width visible cells.
+// The first line starts with firstPrefix, the following ones with restPrefix.
+func wrapStyled(text string, width int, firstPrefix, restPrefix string) []string {
+	var lines []string
+	prefix := firstPrefix
+	current := prefix
+	currentWidth := visibleWidth(prefix)
+	empty := true
+
+	for _, word := range strings.Fields(text) {
+		wordWidth := visibleWidth(word)
+		if !empty && currentWidth+1+wordWidth > width {
+			lines = append(lines, current)
+			prefix = restPrefix
+			current = prefix
+			currentWidth = visibleWidth(prefix)
+			empty = true
+		}
+		if !empty {
+			current += " "
+			currentWidth++
+		}
+		current += word
+		currentWidth += wordWidth
+		empty = false
+	}
+	return append(lines, current)
+}
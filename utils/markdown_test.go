@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"heading and inline styles", "# Title\n\nSome **bold** and *italic* and `code` text.", "Title\n\nSome bold and italic\nand code text."},
+		{"lists", "- one\n- two\n  - nested\n1. first\n2) second", "• one\n• two\n  • nested\n1. first\n2) second"},
+		{"block quote", "> quoted text", "│ quoted text"},
+		{"table", "| a | b |\n|---|---|\n| 1 | 22 |", "╭───┬────╮\n│ a │ b  │\n├───┼────┤\n│ 1 │ 22 │\n╰───┴────╯"},
+		{"code block", "```go\nfunc main() {}\n```", "╭─ go\n│ func main() {}\n╰─"},
+		{"link, rule and blank lines", "See [docs](https://example.com).\n\n---\n\n\n\nend", "See docs\n(https://example.com).\n\n" + strings.Repeat("─", 20) + "\n\nend"},
+		{"paragraph wrapping", "a paragraph that is long enough to be wrapped at twenty cells", "a paragraph that is\nlong enough to be\nwrapped at twenty\ncells"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := stripANSI(RenderMarkdown(test.input, 20)); got != test.want {
+				t.Errorf("RenderMarkdown(%q) =\n%s\nwant\n%s", test.input, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRenderInlineKeepsCodeSpans(t *testing.T) {
+	got := stripANSI(renderInline("use `**not bold**` and **bold**"))
+	if want := "use **not bold** and bold"; got != want {
+		t.Errorf("renderInline() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderTableFitsWidth(t *testing.T) {
+	rows := [][]string{{"name", "description"}, {"x", strings.Repeat("long text ", 10)}}
+	for _, line := range renderTable(rows, 30) {
+		if width := visibleWidth(line); width > 30 {
+			t.Errorf("renderTable() line %q is %d cells wide, want at most 30", stripANSI(line), width)
+		}
+	}
+}
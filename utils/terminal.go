@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultTerminalWidth is used when the terminal size can't be detected
+const defaultTerminalWidth = 80
+
+// IsTerminal reports whether f is attached to a terminal
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// defaultTerminalHeight is used when the terminal size can't be detected
+const defaultTerminalHeight = 24
+
+// outputWidth, when set, makes formatting behave as if stdout were a terminal
+// of that width. The full-screen UI uses it while it captures stdout.
+var outputWidth int
+
+// SetOutputWidth forces the width used to format output; 0 restores detection
+func SetOutputWidth(width int) {
+	outputWidth = width
+}
+
+// StdoutIsTerminal reports whether output should be formatted for a terminal
+func StdoutIsTerminal() bool {
+	return outputWidth > 0 || IsTerminal(os.Stdout)
+}
+
+// TerminalWidth returns the width available to format output, in cells
+func TerminalWidth() int {
+	if outputWidth > 0 {
+		return outputWidth
+	}
+	width, _ := TerminalSize()
+	return width
+}
+
+// terminalSize caches the size read with `stty size`, which runs a command,
+// until the terminal is resized
+var terminalSize struct {
+	mu     sync.Mutex
+	known  bool
+	width  int
+	height int
+}
+
+// TerminalSize returns the terminal width and height in cells, from $COLUMNS
+// and $LINES or `stty size`, falling back to 80x24
+func TerminalSize() (int, int) {
+	terminalSize.mu.Lock()
+	if !terminalSize.known {
+		terminalSize.width, terminalSize.height = readTerminalSize()
+		terminalSize.known = true
+		watchResize.Do(func() {
+			onResize(func() {
+				terminalSize.mu.Lock()
+				terminalSize.known = false
+				terminalSize.mu.Unlock()
+			})
+		})
+	}
+	width, height := terminalSize.width, terminalSize.height
+	terminalSize.mu.Unlock()
+
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		width = columns
+	}
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 0 {
+		height = lines
+	}
+	return width, height
+}
+
+// watchResize starts the resize notifications once
+var watchResize sync.Once
+
+// readTerminalSize asks the terminal on stdin for its size
+func readTerminalSize() (int, int) {
+	width, height := defaultTerminalWidth, defaultTerminalHeight
+	if !IsTerminal(os.Stdin) {
+		return width, height
+	}
+	cmd := exec.Command("stty", "size")
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	if err != nil {
+		return width, height
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return width, height
+	}
+	if rows, err := strconv.Atoi(fields[0]); err == nil && rows > 0 {
+		height = rows
+	}
+	if columns, err := strconv.Atoi(fields[1]); err == nil && columns > 0 {
+		width = columns
+	}
+	return width, height
+}
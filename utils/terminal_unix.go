@@ -0,0 +1,20 @@
+//go:build !windows
+
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// onResize calls resized whenever the terminal window changes size
+func onResize(resized func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		for range signals {
+			resized()
+		}
+	}()
+}
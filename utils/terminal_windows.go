@@ -0,0 +1,5 @@
+package utils
+
+// onResize does nothing, Windows has no resize signal and no stty, so the
+// size is never read from the terminal
+func onResize(resized func()) {}
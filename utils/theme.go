@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/KacemMathlouthi/go-code/config"
+)
+
+// Color modes accepted by ConfigureColors
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// DefaultTheme is used when no theme is configured
+const DefaultTheme = "dark"
+
+// Theme is the palette behind the Color variables. Fields left empty in a
+// custom theme keep the value of the dark theme.
+type Theme struct {
+	Red       string `json:"red"`
+	Green     string `json:"green"`
+	Yellow    string `json:"yellow"`
+	Blue      string `json:"blue"`
+	Magenta   string `json:"magenta"`
+	Cyan      string `json:"cyan"`
+	White     string `json:"white"`
+	Bold      string `json:"bold"`
+	Dim       string `json:"dim"`
+	Italic    string `json:"italic"`
+	Underline string `json:"underline"`
+}
+
+// themes are the built-in themes
+var themes = map[string]Theme{
+	"dark": {
+		Red: "\033[31m", Green: "\033[32m", Yellow: "\033[33m", Blue: "\033[34m",
+		Magenta: "\033[35m", Cyan: "\033[36m", White: "\033[37m",
+		Bold: "\033[1m", Dim: "\033[2m", Italic: "\033[3m", Underline: "\033[4m",
+	},
+	// Darker tones that stay readable on a light background
+	"light": {
+		Red: "\033[38;5;124m", Green: "\033[38;5;28m", Yellow: "\033[38;5;130m", Blue: "\033[38;5;19m",
+		Magenta: "\033[38;5;90m", Cyan: "\033[38;5;24m", White: "\033[30m",
+		Bold: "\033[1m", Dim: "\033[38;5;243m", Italic: "\033[3m", Underline: "\033[4m",
+	},
+	// Bright colors and no dimmed or italic text
+	"high-contrast": {
+		Red: "\033[91m", Green: "\033[92m", Yellow: "\033[93m", Blue: "\033[94m",
+		Magenta: "\033[95m", Cyan: "\033[96m", White: "\033[97m",
+		Bold: "\033[1m", Dim: "\033[97m", Italic: "\033[1m", Underline: "\033[4m",
+	},
+}
+
+// ConfigureColors applies the color mode and theme to the Color variables.
+// In auto mode colors are used when stdout is a terminal, TERM is not "dumb"
+// and NO_COLOR is not set.
+func ConfigureColors(mode, themeName string) error {
+	if mode == "" {
+		mode = ColorAuto
+	}
+	var enabled bool
+	switch mode {
+	case ColorAlways:
+		enabled = true
+	case ColorNever:
+		enabled = false
+	case ColorAuto:
+		enabled = IsTerminal(os.Stdout) && os.Getenv("TERM") != "dumb" && os.Getenv("NO_COLOR") == ""
+	default:
+		return fmt.Errorf("invalid color mode %q, use auto, always or never", mode)
+	}
+
+	theme, err := LoadTheme(themeName)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		theme = Theme{}
+		ColorReset = ""
+	} else {
+		ColorReset = "\033[0m"
+	}
+
+	ColorRed, ColorGreen, ColorYellow, ColorBlue = theme.Red, theme.Green, theme.Yellow, theme.Blue
+	ColorMagenta, ColorCyan, ColorWhite = theme.Magenta, theme.Cyan, theme.White
+	ColorBold, ColorDim, ColorItalic, ColorUnderline = theme.Bold, theme.Dim, theme.Italic, theme.Underline
+	return nil
+}
+
+// LoadTheme returns a built-in theme or a custom one from
+// <config dir>/themes/<name>.json, which may override a built-in theme
+func LoadTheme(name string) (Theme, error) {
+	if name == "" {
+		name = DefaultTheme
+	}
+
+	theme, builtin := themes[name]
+	if !builtin {
+		theme = themes[DefaultTheme]
+	}
+
+	dir, err := config.ConfigDir()
+	if err == nil {
+		data, err := os.ReadFile(filepath.Join(dir, "themes", name+".json"))
+		if err == nil {
+			var custom Theme
+			if err := json.Unmarshal(data, &custom); err != nil {
+				return Theme{}, fmt.Errorf("invalid theme %q: %v", name, err)
+			}
+			return theme.merge(custom), nil
+		}
+	}
+
+	if !builtin {
+		return Theme{}, fmt.Errorf("unknown theme %q, available themes: %v", name, ThemeNames())
+	}
+	return theme, nil
+}
+
+// ThemeNames lists the built-in themes
+func ThemeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// merge returns t with the non-empty fields of custom. Custom values may be
+// full escape sequences or SGR parameters such as "1;38;5;208".
+func (t Theme) merge(custom Theme) Theme {
+	fields := []struct{ base, override *string }{
+		{&t.Red, &custom.Red}, {&t.Green, &custom.Green}, {&t.Yellow, &custom.Yellow},
+		{&t.Blue, &custom.Blue}, {&t.Magenta, &custom.Magenta}, {&t.Cyan, &custom.Cyan},
+		{&t.White, &custom.White}, {&t.Bold, &custom.Bold}, {&t.Dim, &custom.Dim},
+		{&t.Italic, &custom.Italic}, {&t.Underline, &custom.Underline},
+	}
+	for _, field := range fields {
+		switch value := *field.override; {
+		case value == "":
+		case strings.HasPrefix(value, "\033"):
+			*field.base = value
+		default:
+			*field.base = "\033[" + value + "m"
+		}
+	}
+	return t
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"github.com/KacemMathlouthi/go-code/lsp"
 	"github.com/openai/openai-go"
 )
 
@@ -146,4 +147,241 @@ var ToolsDefinitions = []openai.ChatCompletionToolParam{
 			},
 		},
 	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "git_status",
+			Description: openai.String("Show the current git branch and the staged, unstaged, untracked and conflicted files of the repository."),
+			Parameters: openai.FunctionParameters{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "git_diff",
+			Description: openai.String("Show the uncommitted changes of the repository as a unified diff, preceded by a summary of the changed files."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"paths": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Files or directories to limit the diff to (e.g., [\"cmd/root.go\", \"utils\"]). Empty for the whole repository.",
+					},
+					"staged": map[string]interface{}{
+						"type":        "string",
+						"description": "'true' to show the staged changes instead of the unstaged ones.",
+						"enum":        []string{"true", "false"},
+					},
+				},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "git_log",
+			Description: openai.String("List recent commits, one per line: short hash, date, author, refs and subject."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{
+						"type":        "string",
+						"description": "Maximum number of commits to list (default 20, at most 200).",
+					},
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Only list the commits that changed this file or directory.",
+					},
+				},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "git_blame",
+			Description: openai.String("Show the commit, author and date that last changed each line of a file."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the file to blame.",
+					},
+					"start_line": map[string]interface{}{
+						"type":        "string",
+						"description": "First line to blame (e.g., '10'). Empty to start at the top.",
+					},
+					"end_line": map[string]interface{}{
+						"type":        "string",
+						"description": "Last line to blame (e.g., '40'). Empty to go to the end of the file.",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "git_show",
+			Description: openai.String("Show the message, changed files and patch of a commit."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"revision": map[string]interface{}{
+						"type":        "string",
+						"description": "Commit hash, branch or tag to show (e.g., 'a1b2c3d', 'HEAD~2'). Defaults to HEAD.",
+					},
+				},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "git_commit",
+			Description: openai.String("Create a git commit of the staged changes, staging the given paths first. The user may be asked to approve it."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"message": map[string]interface{}{
+						"type":        "string",
+						"description": "The commit message: a short subject line, optionally followed by a blank line and a body.",
+					},
+					"paths": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Files to stage before committing. Empty to commit what is already staged.",
+					},
+				},
+				"required": []string{"message"},
+			},
+		},
+	},
+}
+
+// LSPToolsDefinitions query the language servers, they are only offered when
+// one is installed
+var LSPToolsDefinitions = []openai.ChatCompletionToolParam{
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_definition",
+			Description: openai.String("Find where a symbol is declared, following imports across packages and dependencies. More precise than grep."),
+			Parameters:  lspPositionParameters(nil),
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_references",
+			Description: openai.String("List every place a symbol is used in the workspace, including its declaration. Use before changing a function signature or type."),
+			Parameters:  lspPositionParameters(nil),
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_hover",
+			Description: openai.String("Show the type, signature and documentation of a symbol."),
+			Parameters:  lspPositionParameters(nil),
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_symbols",
+			Description: openai.String("Outline the declarations of a file (types, functions, methods, fields...) with their line ranges."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the source file to outline.",
+					},
+				},
+				"required": []string{"path"},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_workspace_symbols",
+			Description: openai.String("Search the declarations of the whole workspace by name, returning where each match is declared."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{
+						"type":        "string",
+						"description": "The name or part of the name to search for (e.g., 'ExecuteTool', 'Config').",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_rename",
+			Description: openai.String("Rename a symbol and all its references across the workspace, writing the changed files. The user may be asked to approve it."),
+			Parameters: lspPositionParameters(map[string]interface{}{
+				"new_name": map[string]interface{}{
+					"type":        "string",
+					"description": "The new name of the symbol.",
+				},
+			}),
+		},
+	},
+	{
+		Function: openai.FunctionDefinitionParam{
+			Name:        "lsp_diagnostics",
+			Description: openai.String("Show the compile errors and warnings the language server reports for a file, or for every file it analyzed."),
+			Parameters: openai.FunctionParameters{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{
+						"type":        "string",
+						"description": "Path to the source file to check. Empty for all the diagnostics reported so far.",
+					},
+				},
+			},
+		},
+	},
+}
+
+// lspPositionParameters are the parameters locating a symbol in a file, plus
+// the extra ones given
+func lspPositionParameters(extra map[string]interface{}) openai.FunctionParameters {
+	properties := map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "Path to the source file containing the symbol.",
+		},
+		"line": map[string]interface{}{
+			"type":        "string",
+			"description": "Line number of the symbol, starting at 1 (e.g., '42').",
+		},
+		"symbol": map[string]interface{}{
+			"type":        "string",
+			"description": "The identifier on that line to look up (e.g., 'ExecuteTool'). Either symbol or column is required.",
+		},
+		"column": map[string]interface{}{
+			"type":        "string",
+			"description": "Column of the symbol on that line, starting at 1, used when symbol is empty.",
+		},
+	}
+	required := []string{"path", "line"}
+	for name, property := range extra {
+		properties[name] = property
+		required = append(required, name)
+	}
+	return openai.FunctionParameters{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// AvailableTools returns the tools offered to the model: the built-in ones,
+// and the LSP tools when a language server is installed
+func AvailableTools() []openai.ChatCompletionToolParam {
+	if !lsp.Available() {
+		return ToolsDefinitions
+	}
+	return append(append([]openai.ChatCompletionToolParam(nil), ToolsDefinitions...), LSPToolsDefinitions...)
 }
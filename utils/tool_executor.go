@@ -3,15 +3,21 @@ package utils
 import (
 	"fmt"
 
+	"github.com/KacemMathlouthi/go-code/lsp"
 	"github.com/KacemMathlouthi/go-code/tools"
 )
 
-func ExecuteTool(toolName string, toolArgs map[string]string) (string, error) {
+// maxGitOutput caps diffs, blames and commits so they fit in the model's context
+const maxGitOutput = 30000
+
+// ExecuteTool runs a tool. beforeChange, when not nil, is called with each
+// file a multi-file edit such as lsp_rename is about to change.
+func ExecuteTool(toolName string, toolArgs map[string]string, beforeChange func(path string) error) (string, error) {
 	switch toolName {
 	case "shell":
 		result, err := tools.Shell(toolArgs["command"])
 		if err != nil {
-			return "", fmt.Errorf("error executing shell command: %v", err)
+			return "", fmt.Errorf("error executing shell command: %w", err)
 		}
 		return result, nil
 
@@ -71,7 +77,113 @@ func ExecuteTool(toolName string, toolArgs map[string]string) (string, error) {
 		}
 		return fmt.Sprintf("Directory at the path %v was successfully created", toolArgs["path"]), nil
 
+	case "git_status":
+		result, err := tools.GitStatus()
+		if err != nil {
+			return gitFailure("error getting git status", err), nil
+		}
+		return result, nil
+
+	case "git_diff":
+		result, err := tools.GitDiff(toolArgs["paths"], toolArgs["staged"] == "true")
+		if err != nil {
+			return gitFailure("error getting git diff", err), nil
+		}
+		return truncateGitOutput(result), nil
+
+	case "git_log":
+		result, err := tools.GitLog(toolArgs["limit"], toolArgs["path"])
+		if err != nil {
+			return gitFailure("error getting git log", err), nil
+		}
+		return result, nil
+
+	case "git_blame":
+		result, err := tools.GitBlame(toolArgs["path"], toolArgs["start_line"], toolArgs["end_line"])
+		if err != nil {
+			return gitFailure("error getting git blame", err), nil
+		}
+		return truncateGitOutput(result), nil
+
+	case "git_show":
+		result, err := tools.GitShow(toolArgs["revision"])
+		if err != nil {
+			return gitFailure("error showing git commit", err), nil
+		}
+		return truncateGitOutput(result), nil
+
+	case "git_commit":
+		result, err := tools.GitCommit(toolArgs["message"], toolArgs["paths"])
+		if err != nil {
+			return gitFailure("error creating git commit", err), nil
+		}
+		return result, nil
+
+	case "lsp_definition":
+		result, err := lsp.Definition(toolArgs["path"], toolArgs["line"], toolArgs["symbol"], toolArgs["column"])
+		if err != nil {
+			return "", fmt.Errorf("error finding definition: %v", err)
+		}
+		return result, nil
+
+	case "lsp_references":
+		result, err := lsp.References(toolArgs["path"], toolArgs["line"], toolArgs["symbol"], toolArgs["column"])
+		if err != nil {
+			return "", fmt.Errorf("error finding references: %v", err)
+		}
+		return result, nil
+
+	case "lsp_hover":
+		result, err := lsp.Hover(toolArgs["path"], toolArgs["line"], toolArgs["symbol"], toolArgs["column"])
+		if err != nil {
+			return "", fmt.Errorf("error getting symbol information: %v", err)
+		}
+		return result, nil
+
+	case "lsp_symbols":
+		result, err := lsp.DocumentSymbols(toolArgs["path"])
+		if err != nil {
+			return "", fmt.Errorf("error listing symbols: %v", err)
+		}
+		return result, nil
+
+	case "lsp_workspace_symbols":
+		result, err := lsp.WorkspaceSymbols(toolArgs["query"])
+		if err != nil {
+			return "", fmt.Errorf("error searching symbols: %v", err)
+		}
+		return result, nil
+
+	case "lsp_rename":
+		result, err := lsp.Rename(toolArgs["path"], toolArgs["line"], toolArgs["symbol"], toolArgs["column"], toolArgs["new_name"], beforeChange)
+		if err != nil {
+			return "", fmt.Errorf("error renaming symbol: %v", err)
+		}
+		return result, nil
+
+	case "lsp_diagnostics":
+		result, err := lsp.Diagnostics(toolArgs["path"])
+		if err != nil {
+			return "", fmt.Errorf("error getting diagnostics: %v", err)
+		}
+		return result, nil
+
 	default:
 		return "", fmt.Errorf("tool %v not found", toolName)
 	}
 }
+
+// truncateGitOutput cuts long git output and says how much was left out
+func truncateGitOutput(output string) string {
+	kept := TruncateText(output, maxGitOutput)
+	if len(kept) == len(output) {
+		return output
+	}
+	return kept + fmt.Sprintf("\n... output truncated, %d more bytes; narrow it down with paths\n", len(output)-len(kept))
+}
+
+// gitFailure turns a failed git command into the tool result, so the model
+// reads git's error and can correct the call instead of the turn ending
+func gitFailure(context string, err error) string {
+	return fmt.Sprintf("%s: %v", context, err)
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TruncateText cuts text to at most limit bytes, after the last complete line
+// when there is one and otherwise never inside a UTF-8 character. Callers say
+// how much was left out, len(text) minus the length of the result.
+func TruncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	if limit <= 0 {
+		return ""
+	}
+	if cut := strings.LastIndexByte(text[:limit], '\n'); cut > 0 {
+		return text[:cut]
+	}
+	for limit > 0 && !utf8.RuneStart(text[limit]) {
+		limit--
+	}
+	return text[:limit]
+}
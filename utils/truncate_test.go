@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateText(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		want  string
+	}{
+		{"short", "abc", 10, "abc"},
+		{"exact", "abc", 3, "abc"},
+		{"no room", "abc", 0, ""},
+		{"line boundary", "first line\nsecond line", 15, "first line"},
+		{"first line too long", "abcdef\nghi", 4, "abcd"},
+		{"rune boundary", "ééé", 3, "é"},
+		{"wide rune boundary", "日本語", 5, "日"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := TruncateText(test.text, test.limit); got != test.want {
+				t.Errorf("TruncateText(%q, %d) = %q, want %q", test.text, test.limit, got, test.want)
+			}
+		})
+	}
+
+	for _, text := range []string{strings.Repeat("日本語", 1000), strings.Repeat(strings.Repeat("é", 40)+"\n", 100)} {
+		for limit := 1; limit < 200; limit++ {
+			got := TruncateText(text, limit)
+			if !utf8.ValidString(got) || len(got) > limit {
+				t.Fatalf("TruncateText(%d) = %d bytes, valid UTF-8 %v", limit, len(got), utf8.ValidString(got))
+			}
+		}
+	}
+}
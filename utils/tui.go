@@ -0,0 +1,564 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxInputRows is the height limit of the input area
+	maxInputRows = 5
+	// maxActivityRows is the height limit of the tool activity panel
+	maxActivityRows = 3
+	// maxPaneLines bounds the scrollback of the conversation pane
+	maxPaneLines = 5000
+	// resetAttributes ends the reverse video of the status bar, which is kept
+	// when colors are disabled
+	resetAttributes = "\033[0m"
+)
+
+// TUIStatus is the information shown in the status bar
+type TUIStatus struct {
+	Model     string
+	Tokens    int64
+	Cwd       string
+	GitBranch string
+}
+
+// tuiKey is a key press decoded by the key reader
+type tuiKey struct {
+	r     rune
+	name  string
+	paste []rune
+}
+
+// TUI is a full-screen terminal interface: a scrollable conversation pane, a
+// tool activity panel, a status bar and an input area. Everything written to
+// stdout while it runs is shown in the conversation pane.
+type TUI struct {
+	// Submit handles an input line in the background and returns false to quit
+	Submit func(input string) bool
+	// Started, when set, runs once the output is captured, e.g. to print a banner
+	Started   func()
+	Completer Completer
+	History   []string
+
+	mu       sync.Mutex
+	terminal *os.File
+	width    int
+	height   int
+	status   TUIStatus
+
+	// conversation pane
+	lines   []string
+	partial string
+	scroll  int
+
+	// tool activity panel
+	tool      string
+	toolStart time.Time
+	finished  []string
+
+	// input area
+	input     lineBuffer
+	busy      bool
+	busyStart time.Time
+	question  string
+	answers   chan string
+	notice    string
+}
+
+// Run takes over the terminal until Submit returns false or the user presses
+// Ctrl-D on an empty input
+func (t *TUI) Run() error {
+	if !IsTerminal(os.Stdin) || !IsTerminal(os.Stdout) {
+		return errors.New("the full-screen UI needs an interactive terminal")
+	}
+	restore, err := enableRawMode()
+	if err != nil {
+		return fmt.Errorf("failed to enable raw mode: %v", err)
+	}
+	defer restore()
+
+	// Capture stdout so command and agent output lands in the conversation pane
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to capture output: %v", err)
+	}
+	t.terminal = os.Stdout
+	t.answers = make(chan string, 1)
+	t.width, t.height = TerminalSize()
+	SetOutputWidth(t.width)
+	os.Stdout = writer
+
+	fmt.Fprint(t.terminal, "\033[?1049h\033[?2004h") // alternate screen, bracketed paste
+	captured := make(chan struct{})
+	go t.capture(reader, captured)
+	defer func() {
+		os.Stdout = t.terminal
+		writer.Close()
+		<-captured
+		SetOutputWidth(0)
+		fmt.Fprint(t.terminal, "\033[?2004l\033[?1049l")
+	}()
+
+	// Reads return every tenth of a second without input, so the key reader
+	// notices it has to stop instead of swallowing the keys meant for prompts
+	// that follow the UI
+	if _, err := stty("min", "0", "time", "1"); err != nil {
+		return fmt.Errorf("failed to enable raw mode: %v", err)
+	}
+	keys := make(chan tuiKey)
+	stop := make(chan struct{})
+	go readTUIKeys(bufio.NewReader(&stoppableReader{file: os.Stdin, stop: stop}), keys, stop)
+	defer func() {
+		close(stop)
+		for range keys {
+		}
+	}()
+	done := make(chan bool, 1)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+
+	if t.Started != nil {
+		t.Started()
+	}
+	t.redraw()
+	historyIndex := len(t.History)
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			t.mu.Lock()
+			quit := t.handleKey(key, &historyIndex, done)
+			t.redrawLocked()
+			t.mu.Unlock()
+			if quit {
+				return nil
+			}
+		case keepGoing := <-done:
+			t.mu.Lock()
+			t.busy = false
+			t.redrawLocked()
+			t.mu.Unlock()
+			if !keepGoing {
+				return nil
+			}
+		case <-ticker.C:
+			width, height := TerminalSize()
+			t.mu.Lock()
+			if width != t.width || height != t.height {
+				t.width, t.height = width, height
+				SetOutputWidth(width)
+			}
+			t.redrawLocked()
+			t.mu.Unlock()
+		}
+	}
+}
+
+// handleKey applies a key press and reports whether the UI should exit
+func (t *TUI) handleKey(key tuiKey, historyIndex *int, done chan bool) bool {
+	t.notice = ""
+	switch {
+	case key.paste != nil:
+		t.input.insert(key.paste)
+	case key.name == "alt-enter":
+		t.input.insert([]rune{'\n'})
+	case key.name == "left":
+		t.input.move(-1)
+	case key.name == "right":
+		t.input.move(1)
+	case key.name == "home":
+		t.input.cursor = t.input.lineStart()
+	case key.name == "end":
+		t.input.cursor = t.input.lineEnd()
+	case key.name == "delete":
+		t.input.deleteAt(t.input.cursor)
+	case key.name == "pgup":
+		t.scroll += max(t.paneHeight()-1, 1)
+	case key.name == "pgdn":
+		t.scroll = max(t.scroll-max(t.paneHeight()-1, 1), 0)
+	case key.name == "up" && *historyIndex > 0:
+		*historyIndex--
+		t.input.set(t.History[*historyIndex])
+	case key.name == "down" && *historyIndex < len(t.History):
+		*historyIndex++
+		entry := ""
+		if *historyIndex < len(t.History) {
+			entry = t.History[*historyIndex]
+		}
+		t.input.set(entry)
+	case key.name != "":
+	case key.r == '\r':
+		return t.submit(historyIndex, done)
+	case key.r == '\n': // Ctrl-J
+		t.input.insert([]rune{'\n'})
+	case key.r == 3: // Ctrl-C
+		switch {
+		case t.question != "":
+			t.answer("")
+		case len(t.input.buffer) > 0:
+			t.input.set("")
+		case t.busy:
+			t.notice = "The agent is working, wait for it to finish"
+		default:
+			t.notice = "Press Ctrl-D or type /quit to exit"
+		}
+	case key.r == 4: // Ctrl-D
+		if len(t.input.buffer) == 0 && !t.busy && t.question == "" {
+			return true
+		}
+		t.input.deleteAt(t.input.cursor)
+	case key.r == 1: // Ctrl-A
+		t.input.cursor = t.input.lineStart()
+	case key.r == 5: // Ctrl-E
+		t.input.cursor = t.input.lineEnd()
+	case key.r == 11: // Ctrl-K
+		t.input.killToLineEnd()
+	case key.r == 21: // Ctrl-U
+		t.input.killToLineStart()
+	case key.r == 23: // Ctrl-W
+		t.input.killWord()
+	case key.r == 12: // Ctrl-L
+		t.lines, t.partial, t.scroll = nil, "", 0
+	case key.r == 127 || key.r == 8:
+		t.input.backspace()
+	case key.r == '\t':
+		if candidates := t.input.completeWith(t.Completer); len(candidates) > 1 {
+			t.notice = strings.Join(candidates, "  ")
+		}
+	case key.r >= 32:
+		t.input.insert([]rune{key.r})
+	}
+	return false
+}
+
+// submit sends the input to the pending question or to Submit
+func (t *TUI) submit(historyIndex *int, done chan bool) bool {
+	input := string(t.input.buffer)
+	if t.question != "" {
+		t.input.set("")
+		t.answer(input)
+		return false
+	}
+	if t.busy {
+		t.notice = "The agent is working, wait for it to finish"
+		return false
+	}
+	if strings.TrimSpace(input) != "" && (len(t.History) == 0 || t.History[len(t.History)-1] != input) {
+		t.History = append(t.History, input)
+	}
+	*historyIndex = len(t.History)
+	t.input.set("")
+	t.scroll = 0
+	t.finished = nil
+	t.busy = true
+	t.busyStart = time.Now()
+	go func() {
+		done <- t.Submit(input)
+	}()
+	return false
+}
+
+// answer hands a reply to the goroutine waiting in Ask
+func (t *TUI) answer(reply string) {
+	t.appendOutput(t.question + reply + "\n")
+	t.question = ""
+	t.answers <- reply
+}
+
+// Ask shows a question above the input area and waits for the reply. It is
+// called from the goroutine running Submit.
+func (t *TUI) Ask(prompt string) (string, error) {
+	t.mu.Lock()
+	t.question = prompt
+	t.redrawLocked()
+	t.mu.Unlock()
+	return <-t.answers, nil
+}
+
+// SetStatus updates the status bar
+func (t *TUI) SetStatus(status TUIStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.status = status
+	t.redrawLocked()
+}
+
+// ToolStarted shows a running tool in the activity panel
+func (t *TUI) ToolStarted(description string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.tool = description
+	t.toolStart = time.Now()
+	t.redrawLocked()
+}
+
+// ToolFinished moves the running tool to the recent results of the panel
+func (t *TUI) ToolFinished(err error, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	mark := ColorGreen + "✓ " + ColorReset
+	if err != nil {
+		mark = ColorRed + "✗ " + ColorReset
+	}
+	t.finished = append(t.finished, mark+t.tool+" "+ColorDim+fmt.Sprintf("(%s)", duration.Round(time.Millisecond))+ColorReset)
+	t.tool = ""
+	t.redrawLocked()
+}
+
+// redraw repaints the screen
+func (t *TUI) redraw() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.redrawLocked()
+}
+
+// capture copies the captured stdout into the conversation pane
+func (t *TUI) capture(reader io.ReadCloser, done chan struct{}) {
+	defer close(done)
+	defer reader.Close()
+	buf := make([]byte, 4096)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			t.mu.Lock()
+			t.appendOutput(string(buf[:n]))
+			t.redrawLocked()
+			t.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// appendOutput adds terminal output to the pane, honoring screen clears and
+// carriage returns
+func (t *TUI) appendOutput(text string) {
+	if i := strings.LastIndex(text, "\033[2J"); i >= 0 {
+		t.lines, t.partial = nil, ""
+		text = text[i+len("\033[2J"):]
+	}
+	text = strings.NewReplacer("\033[H", "", "\033[K", "").Replace(text)
+
+	for _, r := range text {
+		switch r {
+		case '\n':
+			t.lines = append(t.lines, t.partial)
+			t.partial = ""
+		case '\r':
+			t.partial = ""
+		default:
+			t.partial += string(r)
+		}
+	}
+	if len(t.lines) > maxPaneLines {
+		t.lines = t.lines[len(t.lines)-maxPaneLines:]
+	}
+}
+
+// inputRows lays out the prompt and input, returning the visible rows and the
+// cursor position within them
+func (t *TUI) inputRows() ([]string, int, int) {
+	prompt := ColorCyan + ColorBold + "> " + ColorReset
+	if t.question != "" {
+		prompt = t.question
+	}
+	if t.width < 2 {
+		return []string{prompt}, 0, 0
+	}
+
+	rows := []string{prompt}
+	col := visibleWidth(prompt)
+	cursorRow, cursorCol := 0, col
+	for i, r := range t.input.buffer {
+		if r != '\n' && col+runeWidth(r) > t.width {
+			rows = append(rows, "")
+			col = 0
+		}
+		if i == t.input.cursor {
+			cursorRow, cursorCol = len(rows)-1, col
+		}
+		if r == '\n' {
+			rows = append(rows, continuationPrompt())
+			col = visibleWidth(continuationPrompt())
+			continue
+		}
+		rows[len(rows)-1] += string(r)
+		col += runeWidth(r)
+	}
+	if t.input.cursor == len(t.input.buffer) {
+		cursorRow, cursorCol = len(rows)-1, col
+	}
+
+	// Keep the cursor row visible
+	first := max(cursorRow-maxInputRows+1, 0)
+	last := min(first+maxInputRows, len(rows))
+	return rows[first:last], cursorRow - first, min(cursorCol, t.width-1)
+}
+
+// activityRows returns the tool activity panel
+func (t *TUI) activityRows() []string {
+	var rows []string
+	limit := maxActivityRows
+	if t.tool != "" {
+		limit--
+	}
+	start := max(len(t.finished)-limit, 0)
+	rows = append(rows, t.finished[start:]...)
+	if t.tool != "" {
+		frame := spinnerFrames[int(time.Since(t.toolStart)/(100*time.Millisecond))%len(spinnerFrames)]
+		elapsed := time.Since(t.toolStart).Truncate(100 * time.Millisecond)
+		rows = append(rows, ColorCyan+frame+ColorReset+" "+t.tool+" "+ColorDim+fmt.Sprintf("(%s)", elapsed)+ColorReset)
+	}
+	return rows
+}
+
+// statusBar renders the status line in reverse video
+func (t *TUI) statusBar() string {
+	parts := []string{t.status.Model, fmt.Sprintf("%d tokens", t.status.Tokens), t.status.Cwd}
+	if t.status.GitBranch != "" {
+		parts = append(parts, "⎇ "+t.status.GitBranch)
+	}
+	switch {
+	case t.question != "":
+		parts = append(parts, "waiting for you")
+	case t.busy:
+		parts = append(parts, fmt.Sprintf("working %s", time.Since(t.busyStart).Truncate(time.Second)))
+	case t.scroll > 0:
+		parts = append(parts, "scrolled, PgDn to follow")
+	}
+	bar := " " + strings.Join(parts, " │ ")
+	bar = truncateStyled(bar, t.width)
+	return "\033[7m" + bar + strings.Repeat(" ", max(t.width-visibleWidth(bar), 0)) + resetAttributes
+}
+
+// paneHeight is the number of rows left for the conversation pane
+func (t *TUI) paneHeight() int {
+	input, _, _ := t.inputRows()
+	rows := t.height - len(input) - len(t.activityRows()) - 1
+	if t.notice != "" {
+		rows--
+	}
+	return max(rows, 1)
+}
+
+// paneRows wraps the conversation to the terminal width and returns the rows
+// visible at the current scroll position
+func (t *TUI) paneRows(height int) []string {
+	var rows []string
+	lines := t.lines
+	if t.partial != "" {
+		lines = append(lines[:len(lines):len(lines)], t.partial)
+	}
+	for _, line := range lines {
+		rows = append(rows, hardWrapStyled(line, t.width)...)
+	}
+
+	t.scroll = min(t.scroll, max(len(rows)-height, 0))
+	end := len(rows) - t.scroll
+	start := max(end-height, 0)
+	return rows[start:end]
+}
+
+// redrawLocked repaints the whole screen; t.mu must be held
+func (t *TUI) redrawLocked() {
+	if t.terminal == nil {
+		return
+	}
+	height := t.paneHeight()
+	pane := t.paneRows(height)
+	input, cursorRow, cursorCol := t.inputRows()
+
+	var rows []string
+	rows = append(rows, pane...)
+	for len(rows) < height {
+		rows = append(rows, "")
+	}
+	rows = append(rows, t.activityRows()...)
+	rows = append(rows, t.statusBar())
+	if t.notice != "" {
+		rows = append(rows, ColorDim+truncateStyled(t.notice, t.width)+ColorReset)
+	}
+	inputTop := len(rows)
+	rows = append(rows, input...)
+
+	var out strings.Builder
+	out.WriteString("\033[?25l\033[H")
+	for i, row := range rows {
+		if i > 0 {
+			out.WriteString("\r\n")
+		}
+		out.WriteString("\033[2K" + row + resetAttributes)
+	}
+	out.WriteString("\033[J")
+	fmt.Fprintf(&out, "\033[%d;%dH\033[?25h", inputTop+cursorRow+1, cursorCol+1)
+	fmt.Fprint(t.terminal, out.String())
+}
+
+// stoppableReader reads a terminal set to return without input after a
+// timeout, retrying until stop is closed
+type stoppableReader struct {
+	file *os.File
+	stop <-chan struct{}
+}
+
+func (r *stoppableReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || (err != nil && err != io.EOF) {
+			return n, err
+		}
+		select {
+		case <-r.stop:
+			return 0, io.EOF
+		default:
+		}
+	}
+}
+
+// readTUIKeys decodes key presses from stdin until it is closed or stop is
+// closed
+func readTUIKeys(reader *bufio.Reader, keys chan<- tuiKey, stop <-chan struct{}) {
+	defer close(keys)
+	send := func(key tuiKey) bool {
+		select {
+		case keys <- key:
+			return true
+		case <-stop:
+			return false
+		}
+	}
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return
+		}
+		if r != 27 {
+			if !send(tuiKey{r: r}) {
+				return
+			}
+			continue
+		}
+		name := readEscapeKey(reader)
+		if name == "paste" {
+			if !send(tuiKey{paste: readPastedText(reader)}) {
+				return
+			}
+			continue
+		}
+		if name != "" && !send(tuiKey{name: name}) {
+			return
+		}
+	}
+}
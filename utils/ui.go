@@ -2,21 +2,25 @@ package utils
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
-// ANSI color codes for terminal formatting
-const (
-	ColorReset   = "\033[0m"
-	ColorRed     = "\033[31m"
-	ColorGreen   = "\033[32m"
-	ColorYellow  = "\033[33m"
-	ColorBlue    = "\033[34m"
-	ColorMagenta = "\033[35m"
-	ColorCyan    = "\033[36m"
-	ColorWhite   = "\033[37m"
-	ColorBold    = "\033[1m"
-	ColorDim     = "\033[2m"
+// ANSI color codes for terminal formatting, set from the active theme by
+// ConfigureColors and empty when colors are disabled
+var (
+	ColorReset     = "\033[0m"
+	ColorRed       = "\033[31m"
+	ColorGreen     = "\033[32m"
+	ColorYellow    = "\033[33m"
+	ColorBlue      = "\033[34m"
+	ColorMagenta   = "\033[35m"
+	ColorCyan      = "\033[36m"
+	ColorWhite     = "\033[37m"
+	ColorBold      = "\033[1m"
+	ColorDim       = "\033[2m"
+	ColorItalic    = "\033[3m"
+	ColorUnderline = "\033[4m"
 )
 
 // Box drawing characters
@@ -29,80 +33,59 @@ const (
 	Vertical    = "│"
 )
 
+// minBoxWidth is the narrowest content width of a box
+const minBoxWidth = 20
+
 // FormatUserInput formats user input in a styled box
 func FormatUserInput(input string) string {
-	lines := wrapLines(strings.Split(input, "\n"), 80) // wrap at 80 chars
-	maxWidth := 0
-	for _, line := range lines {
-		if len(line) > maxWidth {
-			maxWidth = len(line)
-		}
-	}
-	if maxWidth < 20 {
-		maxWidth = 20
-	}
-	var result strings.Builder
-	result.WriteString(ColorCyan + ColorBold + "👤 User" + ColorReset + "\n")
-	result.WriteString(ColorCyan + TopLeft + strings.Repeat(Horizontal, maxWidth+2) + TopRight + ColorReset + "\n")
-	for _, line := range lines {
-		padding := maxWidth - len(line)
-		result.WriteString(ColorCyan + Vertical + ColorReset + " " + line + strings.Repeat(" ", padding) + " " + ColorCyan + Vertical + ColorReset + "\n")
-	}
-	result.WriteString(ColorCyan + BottomLeft + strings.Repeat(Horizontal, maxWidth+2) + BottomRight + ColorReset + "\n")
-	return result.String()
+	return formatBox(ColorCyan+ColorBold+"👤 User"+ColorReset, ColorCyan, input)
 }
 
-// FormatAIResponse prints only the bot tag and the raw output, no box or formatting
+// FormatAIResponse prints the bot tag followed by the response rendered as
+// markdown, or the raw response when stdout is not a terminal
 func FormatAIResponse(response string) string {
-	return "🤖 " + ColorMagenta + ColorBold + "AI Assistant" + ColorReset + "\n" + response
+	if !StdoutIsTerminal() {
+		return response
+	}
+	return "🤖 " + ColorMagenta + ColorBold + "AI Assistant" + ColorReset + "\n" + RenderMarkdown(response, TerminalWidth())
 }
 
-// wrapLines wraps each line in the input slice to the given width
+// wrapLines word-wraps each line to the given width in terminal cells
 func wrapLines(lines []string, width int) []string {
 	var wrapped []string
 	for _, line := range lines {
-		for len(line) > width {
-			wrapped = append(wrapped, line[:width])
-			line = line[width:]
-		}
-		wrapped = append(wrapped, line)
+		line = strings.ReplaceAll(line, "\t", strings.Repeat(" ", tabWidth))
+		wrapped = append(wrapped, wrapText(line, width)...)
 	}
 	return wrapped
 }
 
 // FormatError formats error messages in a styled box
 func FormatError(err string) string {
-	lines := strings.Split(err, "\n")
-	maxWidth := 0
+	return formatBox(ColorRed+ColorBold+"❌ Error"+ColorReset, ColorRed, err)
+}
 
-	// Find the maximum line width
-	for _, line := range lines {
-		if len(line) > maxWidth {
-			maxWidth = len(line)
-		}
-	}
+// formatBox draws text in a box with a colored border under a title. The box
+// fits the terminal width and its content is word-wrapped to fit.
+func formatBox(title, borderColor, text string) string {
+	// Leave room for the borders and the padding around the content
+	available := max(TerminalWidth()-4, 1)
+	lines := wrapLines(strings.Split(strings.TrimRight(text, "\n"), "\n"), available)
 
-	// Ensure minimum width
-	if maxWidth < 20 {
-		maxWidth = 20
+	width := 0
+	for _, line := range lines {
+		width = max(width, visibleWidth(line))
 	}
+	width = min(max(width, minBoxWidth), available)
 
-	// Build the formatted output
 	var result strings.Builder
-
-	// Top border with error icon
-	result.WriteString(ColorRed + ColorBold + "❌ Error" + ColorReset + "\n")
-	result.WriteString(ColorRed + TopLeft + strings.Repeat(Horizontal, maxWidth+2) + TopRight + ColorReset + "\n")
-
-	// Content lines
+	result.WriteString(title + "\n")
+	result.WriteString(borderColor + TopLeft + strings.Repeat(Horizontal, width+2) + TopRight + ColorReset + "\n")
 	for _, line := range lines {
-		padding := maxWidth - len(line)
-		result.WriteString(ColorRed + Vertical + ColorReset + " " + line + strings.Repeat(" ", padding) + " " + ColorRed + Vertical + ColorReset + "\n")
+		padding := max(width-visibleWidth(line), 0)
+		result.WriteString(borderColor + Vertical + ColorReset + " " + line + strings.Repeat(" ", padding) + " " + borderColor + Vertical + ColorReset + "\n")
 	}
-
-	// Bottom border
-	result.WriteString(ColorRed + BottomLeft + strings.Repeat(Horizontal, maxWidth+2) + BottomRight + ColorReset + "\n")
-
+	result.WriteString(borderColor + BottomLeft + strings.Repeat(Horizontal, width+2) + BottomRight + ColorReset + "\n")
 	return result.String()
 }
 
@@ -111,9 +94,23 @@ func FormatPrompt() string {
 	return ColorCyan + ColorBold + "> " + ColorReset
 }
 
-// ClearScreen clears the terminal screen with a nice message
+// FormatContinuePrompt asks whether the agent may keep going after using its step budget
+func FormatContinuePrompt(stepsUsed int) string {
+	return ColorYellow + ColorBold + fmt.Sprintf("⏳ The agent has used %d steps. Continue? [y/N] ", stepsUsed) + ColorReset
+}
+
+// FormatApprovalPrompt asks the user a yes/no question
+func FormatApprovalPrompt(question string) string {
+	return ColorYellow + ColorBold + "❓ " + question + " [y/N] " + ColorReset
+}
+
+// ClearScreen clears the terminal screen with a nice message. The escape
+// codes are left out when colors are off or stdout is not a terminal, e.g.
+// redirected to a file or captured by the full-screen UI.
 func ClearScreen() {
-	fmt.Print("\033[H\033[2J")
+	if ColorReset != "" && IsTerminal(os.Stdout) {
+		fmt.Print("\033[H\033[2J")
+	}
 	fmt.Println(ColorGreen + ColorBold + "✨ Terminal cleared! Ready for new conversation." + ColorReset)
 	fmt.Println()
 }
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// tabWidth is the number of spaces a tab is expanded to inside boxes
+const tabWidth = 4
+
+// wideRanges lists the code points displayed in two terminal cells: East
+// Asian wide and fullwidth characters and emoji presentation symbols
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x231A, 0x231B}, {0x2329, 0x232A}, {0x23E9, 0x23EC},
+	{0x23F0, 0x23F0}, {0x23F3, 0x23F3}, {0x25FD, 0x25FE}, {0x2614, 0x2615},
+	{0x2648, 0x2653}, {0x267F, 0x267F}, {0x2693, 0x2693}, {0x26A1, 0x26A1},
+	{0x26AA, 0x26AB}, {0x26BD, 0x26BE}, {0x26C4, 0x26C5}, {0x26CE, 0x26CE},
+	{0x26D4, 0x26D4}, {0x26EA, 0x26EA}, {0x26F2, 0x26F3}, {0x26F5, 0x26F5},
+	{0x26FA, 0x26FA}, {0x26FD, 0x26FD}, {0x2705, 0x2705}, {0x270A, 0x270B},
+	{0x2728, 0x2728}, {0x274C, 0x274C}, {0x274E, 0x274E}, {0x2753, 0x2755},
+	{0x2757, 0x2757}, {0x2795, 0x2797}, {0x27B0, 0x27B0}, {0x27BF, 0x27BF},
+	{0x2B1B, 0x2B1C}, {0x2B50, 0x2B50}, {0x2B55, 0x2B55}, {0x2E80, 0x303E},
+	{0x3041, 0x33FF}, {0x3400, 0x4DBF}, {0x4E00, 0x9FFF}, {0xA000, 0xA4CF},
+	{0xA960, 0xA97F}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF}, {0xFE10, 0xFE19},
+	{0xFE30, 0xFE6F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x16FE0, 0x16FE4},
+	{0x17000, 0x18AFF}, {0x1B000, 0x1B2FF}, {0x1F004, 0x1F004}, {0x1F0CF, 0x1F0CF},
+	{0x1F18E, 0x1F18E}, {0x1F191, 0x1F19A}, {0x1F200, 0x1F251}, {0x1F300, 0x1F64F},
+	{0x1F680, 0x1F6FF}, {0x1F7E0, 0x1F7EB}, {0x1F90C, 0x1F9FF}, {0x1FA70, 0x1FAFF},
+	{0x20000, 0x3FFFD},
+}
+
+// runeWidth returns the number of terminal cells used to display r
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x20 || (r >= 0x7F && r < 0xA0):
+		return 0
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		// Combining marks, variation selectors and zero-width joiners
+		return 0
+	}
+	i := sort.Search(len(wideRanges), func(i int) bool { return wideRanges[i][1] >= r })
+	if i < len(wideRanges) && r >= wideRanges[i][0] {
+		return 2
+	}
+	return 1
+}
+
+// stripANSI removes ANSI escape sequences from s
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// visibleWidth returns the number of terminal cells used to display s, ignoring
+// ANSI sequences
+func visibleWidth(s string) int {
+	width := 0
+	for _, r := range stripANSI(s) {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// truncateStyled shortens text to width cells, ending it with an ellipsis
+func truncateStyled(text string, width int) string {
+	if visibleWidth(text) <= width {
+		return text
+	}
+	var b strings.Builder
+	cells := 0
+	for _, r := range stripANSI(text) {
+		if cells+runeWidth(r) > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		cells += runeWidth(r)
+	}
+	return b.String() + "…"
+}
+
+// styledTokens splits text into ANSI sequences, runs of spaces and words
+func styledTokens(text string) []string {
+	var tokens []string
+	for len(text) > 0 {
+		if loc := ansiPattern.FindStringIndex(text); loc != nil && loc[0] == 0 {
+			tokens = append(tokens, text[:loc[1]])
+			text = text[loc[1]:]
+			continue
+		}
+		space := text[0] == ' '
+		end := 0
+		for end < len(text) && text[end] != '\033' && (text[end] == ' ') == space {
+			end++
+		}
+		if end == 0 {
+			// A lone ESC that does not start a sequence
+			end = 1
+		}
+		tokens = append(tokens, text[:end])
+		text = text[end:]
+	}
+	return tokens
+}
+
+// wrapText word-wraps a line to width cells, keeping its spacing and carrying
+// ANSI styles over to the next row. Words wider than a row are split.
+func wrapText(line string, width int) []string {
+	if width <= 0 || visibleWidth(line) <= width {
+		return []string{line}
+	}
+
+	var rows []string
+	var row strings.Builder
+	rowWidth := 0
+	active := ""
+	newRow := func() {
+		if active != "" {
+			row.WriteString(ColorReset)
+		}
+		rows = append(rows, row.String())
+		row.Reset()
+		row.WriteString(active)
+		rowWidth = 0
+	}
+
+	for _, token := range styledTokens(line) {
+		switch {
+		case ansiPattern.MatchString(token):
+			row.WriteString(token)
+			if token == ColorReset {
+				active = ""
+			} else {
+				active += token
+			}
+		case token[0] == ' ':
+			// Spaces at a row break are dropped
+			if rowWidth+len(token) > width {
+				if rowWidth > 0 {
+					newRow()
+				}
+				continue
+			}
+			row.WriteString(token)
+			rowWidth += len(token)
+		default:
+			if rowWidth > 0 && rowWidth+visibleWidth(token) > width {
+				newRow()
+			}
+			for _, r := range token {
+				if rowWidth > 0 && rowWidth+runeWidth(r) > width {
+					newRow()
+				}
+				row.WriteRune(r)
+				rowWidth += runeWidth(r)
+			}
+		}
+	}
+	return append(rows, row.String())
+}
+
+// hardWrapStyled splits a line with ANSI styles into rows of at most width
+// cells, keeping every character and carrying the active style over to the
+// next row
+func hardWrapStyled(line string, width int) []string {
+	if width <= 0 || visibleWidth(line) <= width {
+		return []string{line}
+	}
+
+	var rows []string
+	var row strings.Builder
+	active := ""
+	cells := 0
+	for _, token := range styledTokens(line) {
+		if ansiPattern.MatchString(token) {
+			row.WriteString(token)
+			if token == ColorReset {
+				active = ""
+			} else {
+				active += token
+			}
+			continue
+		}
+		for _, r := range token {
+			if cells > 0 && cells+runeWidth(r) > width {
+				rows = append(rows, row.String()+ColorReset)
+				row.Reset()
+				row.WriteString(active)
+				cells = 0
+			}
+			row.WriteRune(r)
+			cells += runeWidth(r)
+		}
+	}
+	return append(rows, row.String())
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVisibleWidth(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"\033[1;32mhello\033[0m", 5},
+		{"日本語", 6},
+		{"✅ done", 7},
+		{"é", 1},
+		{"a\tb", 2},
+	}
+	for _, test := range tests {
+		if got := visibleWidth(test.text); got != test.want {
+			t.Errorf("visibleWidth(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTruncateStyled(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  string
+	}{
+		{"short", 10, "short"},
+		{"hello world", 8, "hello w…"},
+		{"\033[31mhello world\033[0m", 6, "hello…"},
+		{"日本語テキスト", 7, "日本語…"},
+	}
+	for _, test := range tests {
+		if got := truncateStyled(test.text, test.width); got != test.want {
+			t.Errorf("truncateStyled(%q, %d) = %q, want %q", test.text, test.width, got, test.want)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		width int
+		want  []string
+	}{
+		{"fits", "one two", 10, []string{"one two"}},
+		{"no width", "one two three", 0, []string{"one two three"}},
+		{"words keep their spacing", "one two three four", 9, []string{"one two ", "three ", "four"}},
+		{"spaces at a break dropped", "abcd    efgh", 6, []string{"abcd", "efgh"}},
+		{"long word split", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"wide characters", "日本語テキスト", 6, []string{"日本語", "テキス", "ト"}},
+		{"style carried over", "\033[1mone two\033[0m", 4, []string{"\033[1mone " + ColorReset, "\033[1mtwo\033[0m"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := wrapText(test.line, test.width); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("wrapText(%q, %d) = %q, want %q", test.line, test.width, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHardWrapStyled(t *testing.T) {
+	got := hardWrapStyled("\033[32mabcdef\033[0m", 4)
+	want := []string{"\033[32mabcd" + ColorReset, "\033[32mef\033[0m"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hardWrapStyled() = %q, want %q", got, want)
+	}
+	for _, row := range hardWrapStyled("a b c d e f", 3) {
+		if width := visibleWidth(row); width > 3 {
+			t.Errorf("hardWrapStyled() row %q is %d cells wide, want at most 3", row, width)
+		}
+	}
+}